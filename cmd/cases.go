@@ -0,0 +1,142 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/meln5674/helm-hog/pkg/helmhog"
+)
+
+var (
+	casesStrategy   string
+	casesStrength   int
+	casesSample     int
+	casesSeed       int64
+	casesShardIndex int
+	casesShardCount int
+	casesRefs       []string
+	casesWhere      []string
+	casesSelect     []string
+)
+
+// addCaseFlags adds the flags shared by all commands which generate cases
+func addCaseFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&casesStrategy, "strategy", "", "Case generation strategy, one of exhaustive, pairwise. Overrides generation.strategy in the project")
+	cmd.Flags().IntVar(&casesStrength, "strength", 0, "Number of variables whose combinations of choices must all be covered by the pairwise strategy. Overrides generation.strength in the project")
+	cmd.Flags().IntVar(&casesSample, "sample", 0, "If non-zero, only use this many cases, chosen at random from the generated cases")
+	cmd.Flags().Int64Var(&casesSeed, "seed", 0, "Random seed to use with --sample. If not set, a seed is chosen and printed, which can be passed to this flag to reproduce the same sample")
+	cmd.Flags().StringArrayVar(&casesRefs, "case", []string{}, "Only use the case with this ID or hash, as printed by the list command, instead of generating cases. May be repeated")
+	cmd.Flags().StringArrayVar(&casesWhere, "where", []string{}, "Only use cases matching a comma-separated list of predicates, each of which is variable=choice or variable!=choice, where choice may be a |-separated list of choices, e.g. database=postgres|mysql,ingress!=none. May be repeated, in which case cases must match all of them")
+	cmd.Flags().StringArrayVar(&casesSelect, "select", []string{}, "Only use cases matching the named selector from the project. May be repeated, in which case cases must match all of them")
+	cmd.Flags().IntVar(&casesShardIndex, "shard-index", 0, "Which shard of cases to use, starting at zero. See --shard-count")
+	cmd.Flags().IntVar(&casesShardCount, "shard-count", 1, "Split cases into this many disjoint shards, and only use the one selected by --shard-index. Every shard must use the same project and case flags. If used with --sample, every shard must use the same --seed")
+}
+
+// generateCases applies the case flags to the loaded project and then generates its cases in the background.
+// If explicit is non-nil, those cases are used instead of generating them.
+func generateCases(cmd *cobra.Command, explicit []helmhog.Case) (<-chan helmhog.Case, error) {
+	generation := loadedProject.Generation
+	if casesStrategy != "" {
+		generation.Strategy = helmhog.GenerationStrategy(casesStrategy)
+	}
+	if casesStrength != 0 {
+		generation.Strength = casesStrength
+	}
+	generation, err := generation.Resolve()
+	if err != nil {
+		return nil, err
+	}
+	if casesSample < 0 {
+		return nil, fmt.Errorf("--sample cannot be negative")
+	}
+	if casesShardCount < 1 {
+		return nil, fmt.Errorf("--shard-count must be at least 1")
+	}
+	if casesShardIndex < 0 || casesShardIndex >= casesShardCount {
+		return nil, fmt.Errorf("--shard-index must be at least zero and less than --shard-count")
+	}
+	loadedProject.Generation = generation
+
+	selectors := make([]helmhog.Selector, 0, len(casesWhere)+len(casesSelect))
+	for _, expr := range casesWhere {
+		selector, err := helmhog.ParseSelector(expr)
+		if err == nil {
+			err = selector.Check(loadedProject.Project)
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("invalid --where %s", expr))
+		}
+		selectors = append(selectors, selector)
+	}
+	for _, name := range casesSelect {
+		selector, ok := loadedProject.Selectors[name]
+		if !ok {
+			return nil, fmt.Errorf("No selector named %s", name)
+		}
+		selectors = append(selectors, selector)
+	}
+
+	for _, ref := range casesRefs {
+		c, err := loadedProject.ResolveCase(ref)
+		if err != nil {
+			return nil, err
+		}
+		explicit = append(explicit, c)
+	}
+
+	generated := make(chan helmhog.Case)
+	if explicit != nil {
+		go func() {
+			defer close(generated)
+			for _, c := range explicit {
+				generated <- c
+			}
+		}()
+	} else {
+		go loadedProject.GenerateCases(generated)
+	}
+	cases := (<-chan helmhog.Case)(generated)
+
+	if len(selectors) != 0 {
+		filtered := make(chan helmhog.Case)
+		go helmhog.FilterCases(cases, filtered, func(c helmhog.Case) bool {
+			for _, selector := range selectors {
+				if !selector.Matches(c) {
+					return false
+				}
+			}
+			return true
+		})
+		cases = filtered
+	}
+
+	if casesSample != 0 {
+		if !cmd.Flags().Changed("seed") {
+			casesSeed = time.Now().UnixNano()
+		}
+		fmt.Fprintf(os.Stderr, "Sampling %d cases using seed %d\n", casesSample, casesSeed)
+		sampled := make(chan helmhog.Case)
+		go helmhog.SampleCases(cases, sampled, casesSample, casesSeed)
+		cases = sampled
+	}
+
+	if casesShardCount != 1 {
+		sharded := make(chan helmhog.Case)
+		go helmhog.ShardCases(cases, sharded, casesShardIndex, casesShardCount)
+		cases = sharded
+	}
+
+	return cases, nil
+}
+
+// describeCase formats a case as its hash followed by its ID
+func describeCase(c helmhog.Case) string {
+	return fmt.Sprintf("%s %s", loadedProject.CaseHash(c), loadedProject.CaseID(c))
+}
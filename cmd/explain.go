@@ -0,0 +1,78 @@
+/*
+Copyright © 2023 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/meln5674/helm-hog/pkg/helmhog"
+	"github.com/spf13/cobra"
+)
+
+// explainCmd represents the explain command
+var explainCmd = &cobra.Command{
+	Use:   "explain variable=choice...",
+	Short: "Explain why cases containing a set of mappings are or are not allowed",
+	Long: `Checks if any allowed case contains the given mappings, and if not, which requirements, restrictions, and conditions exclude them.
+
+Mappings may be given as separate arguments, or as a single comma-separated case ID, and do not need to include every variable.
+The requirements which are triggered by the mappings, and by the mappings those requirements imply, are shown in the order they apply.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		mapping, err := loadedProject.ParsePartialCaseID(strings.Join(args, ","))
+		if err != nil {
+			return err
+		}
+		e := loadedProject.Explain(mapping, explainAnalysisLimit)
+
+		if e.Limited {
+			fmt.Printf("Cases containing %s were not checked because there are more than %d of them, use --analysis-limit 0 to check them anyway\n", loadedProject.CaseID(mapping), explainAnalysisLimit)
+		} else if e.Allowed != 0 {
+			fmt.Printf("%d of %d cases containing %s are allowed, for example:\n", e.Allowed, e.Total, loadedProject.CaseID(mapping))
+			fmt.Printf("  %s\n", describeCase(e.Example))
+		} else {
+			fmt.Printf("None of the %d cases containing %s are allowed\n", e.Total, loadedProject.CaseID(mapping))
+		}
+
+		if len(e.Chain) != 0 {
+			fmt.Println("Rules which apply to these mappings, in order:")
+			for _, step := range e.Chain {
+				fmt.Printf("  %s: %s\n", step.Rule, step.Rule.Definition())
+				if len(step.Implies) != 0 {
+					fmt.Printf("    requires %s\n", loadedProject.CaseID(step.Implies))
+				}
+				if step.Conflict != "" {
+					fmt.Printf("    conflict: %s\n", step.Conflict)
+				}
+			}
+		}
+
+		if len(e.Discards) != 0 {
+			fmt.Println("Rules which discard cases containing these mappings:")
+			for _, discards := range e.Discards {
+				fmt.Printf("  %s discards %d of %d cases: %s\n", discards.Rule, discards.Cases, e.Total, discards.Rule.Definition())
+			}
+		}
+
+		if len(e.Blocking) != 0 {
+			blocking := make([]string, 0, len(e.Blocking))
+			for _, rule := range e.Blocking {
+				blocking = append(blocking, rule.String())
+			}
+			fmt.Printf("Together, these rules discard every case containing these mappings: %s\n", strings.Join(blocking, ", "))
+		}
+		return nil
+	},
+}
+
+var (
+	explainAnalysisLimit int
+)
+
+func init() {
+	rootCmd.AddCommand(explainCmd)
+
+	explainCmd.Flags().IntVar(&explainAnalysisLimit, "analysis-limit", helmhog.DefaultAnalysisLimit, "Maximum number of cases containing the mappings to check rules against. If there are more, only the requirements they trigger are shown. 0 means no limit")
+}
@@ -7,8 +7,6 @@ import (
 	"fmt"
 
 	"github.com/spf13/cobra"
-
-	"github.com/meln5674/helm-hog/pkg/helmhog"
 )
 
 // listCmd represents the list command
@@ -21,16 +19,21 @@ and usage of using your command. For example:
 Cobra is a CLI library for Go that empowers applications.
 This application is a tool to generate the needed files
 to quickly create a Cobra application.`,
-	Run: func(cmd *cobra.Command, args []string) {
-		cases := make(chan helmhog.Case)
-		go loadedProject.GenerateCases(cases)
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cases, err := generateCases(cmd, nil)
+		if err != nil {
+			return err
+		}
 
 		for c := range cases {
-			fmt.Println(c)
+			fmt.Println(describeCase(c))
 		}
+		return nil
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(listCmd)
+
+	addCaseFlags(listCmd)
 }
@@ -25,6 +25,12 @@ var (
 
 	helmFlags    []string
 	kubectlFlags []string
+	engine       string
+
+	applyMode            string
+	schemaDir            string
+	kubernetesVersion    string
+	ignoreMissingSchemas bool
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -47,7 +53,12 @@ func Execute() {
 func init() {
 	rootCmd.PersistentFlags().StringVar(&projectPath, "project", "hog.yaml", "Path to project YAML file")
 	rootCmd.PersistentFlags().StringSliceVar(&helmFlags, "helm-flags", []string{}, "Extra flags to pass to the helm command")
+	rootCmd.PersistentFlags().StringVar(&engine, "engine", string(helmhog.DefaultEngine), "How to lint and render cases. One of cli (run the helm command) or sdk (use the built-in Helm libraries, which is faster, but does not support --helm-flags)")
 	rootCmd.PersistentFlags().StringSliceVar(&kubectlFlags, "kubectl-flags", []string{}, "Extra flags to pass to the kubectl command")
+	rootCmd.PersistentFlags().StringVar(&applyMode, "apply-mode", string(helmhog.DefaultApplyMode), "How to validate rendered manifests. One of client (kubectl apply --dry-run=client), schema (validate against the JSON schemas in --schema-dir and the project's CRDs, without kubectl or a cluster), or server (kubectl apply --dry-run=server against the current kube context, in a namespace created for each case)")
+	rootCmd.PersistentFlags().StringVar(&schemaDir, "schema-dir", "", "Directory containing Kubernetes JSON schemas for --apply-mode schema, in the same layout as kubeconform, e.g. <dir>/v1.27.3-standalone-strict/deployment-apps-v1.json")
+	rootCmd.PersistentFlags().StringVar(&kubernetesVersion, "kubernetes-version", helmhog.DefaultKubernetesVersion, "Kubernetes version of the schemas to use from --schema-dir")
+	rootCmd.PersistentFlags().BoolVar(&ignoreMissingSchemas, "ignore-missing-schemas", false, "With --apply-mode schema, skip objects with no schema instead of failing")
 
 	klogFlags := goflag.NewFlagSet("", goflag.PanicOnError)
 	klog.InitFlags(klogFlags)
@@ -67,6 +78,12 @@ func loadProject(*cobra.Command, []string) error {
 	loadedProject, err = project.Load(helmhog.ProjectSettings{
 		KubectlFlags: kubectlFlags,
 		HelmFlags:    helmFlags,
+		Engine:       helmhog.Engine(engine),
+		ApplyMode:    helmhog.ApplyMode(applyMode),
+
+		SchemaDir:            schemaDir,
+		KubernetesVersion:    kubernetesVersion,
+		IgnoreMissingSchemas: ignoreMissingSchemas,
 	})
 	if err != nil {
 		return errors.Wrap(err, "invalid project")
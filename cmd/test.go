@@ -5,9 +5,14 @@ package cmd
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"runtime"
+	"syscall"
+	"time"
 
 	"github.com/meln5674/helm-hog/pkg/helmhog"
 	"github.com/pkg/errors"
@@ -21,7 +26,26 @@ var (
 	testParallel           int
 	testKeepReports        bool
 	testPruneFailedChoices bool
+	testPrune              string
+	testPruneBatch         int
 	testAutoRemoveSuccess  bool
+	testRerunFailed        string
+	testInstall            bool
+	testInstallTimeout     time.Duration
+	testSnapshotDir        string
+	testUpdateSnapshots    bool
+	testReportJUnit        string
+	testReportJSON         string
+	testReportHTML         string
+	testMinimize           bool
+	testMinimizeVerify     int
+	testFailFast           bool
+	testMaxFailures        int
+	testCaseTimeout        time.Duration
+)
+
+const (
+	rerunFailedLatest = "latest"
 )
 
 // testCmd represents the test command
@@ -35,27 +59,95 @@ Cobra is a CLI library for Go that empowers applications.
 This application is a tool to generate the needed files
 to quickly create a Cobra application.`,
 	RunE: func(cmd *cobra.Command, args []string) (err error) {
-		cases := make(chan helmhog.Case)
+		failed := make([]helmhog.Case, 0)
+		skipped := make([]helmhog.Case, 0)
 
 		defer func() {
 			if testKeepReports || (testBatch && err == nil) {
 				fmt.Printf("Reports are found at %s , user is responsible for deleting this directory\n", loadedProject.TempDir)
 				return
 			}
-			os.RemoveAll(loadedProject.TempDir)
+			if len(failed) == 0 && len(skipped) == 0 {
+				loadedProject.RemoveTempDir()
+				return
+			}
+			loadedProject.RemoveTempDir(helmhog.StateFileName)
+			fmt.Printf("State of failed and skipped cases is kept at %s , use --rerun-failed to re-run them\n", loadedProject.StatePath())
 		}()
 
+		var rerun []helmhog.Case
+		// replacedStatePath is the state file which the state of this run replaces once it is written, if any
+		var replacedStatePath string
+		if testRerunFailed != "" {
+			statePath := testRerunFailed
+			if statePath == rerunFailedLatest {
+				statePath, err = helmhog.FindLatestState(projectPath)
+				if err != nil {
+					return err
+				}
+				replacedStatePath = statePath
+			}
+			var state *helmhog.State
+			state, err = helmhog.ReadState(statePath)
+			if err != nil {
+				return err
+			}
+			rerun, err = loadedProject.StateCases(state)
+			if err != nil {
+				return errors.Wrap(err, fmt.Sprintf("load cases from %s", statePath))
+			}
+			fmt.Printf("Re-running %d failed and skipped cases from %s\n", len(rerun), statePath)
+		}
+
+		cases, err := generateCases(cmd, rerun)
+		if err != nil {
+			return err
+		}
+
 		defer func() {
 			for range cases {
 			}
 		}()
 
-		go loadedProject.GenerateCases(cases)
+		if testUpdateSnapshots && testSnapshotDir == "" {
+			return fmt.Errorf("--update-snapshots requires --snapshot-dir")
+		}
+
+		if testMaxFailures < 0 {
+			return fmt.Errorf("--max-failures cannot be negative")
+		}
+		if testFailFast && testMaxFailures == 0 {
+			testMaxFailures = 1
+		}
+
+		// On the first interrupt, stop starting new cases, kill the running ones, and write reports as usual.
+		// Afterwards, the default behavior is restored, so a second interrupt exits immediately.
+		interruptCtx, stopInterrupt := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stopInterrupt()
+		runDone := make(chan struct{})
+		defer close(runDone)
+		go func() {
+			select {
+			case <-interruptCtx.Done():
+			case <-runDone:
+				return
+			}
+			stopInterrupt()
+			fmt.Println("Interrupted, stopping running cases. Interrupt again to exit immediately")
+		}()
+		// runCtx is also cancelled once --max-failures cases have failed
+		runCtx, cancelRun := context.WithCancel(interruptCtx)
+		defer cancelRun()
 
 		fmt.Printf("Reports will be kept at %s\n", loadedProject.TempDir)
 
-		failed := make([]helmhog.Case, 0)
-		skipped := make([]helmhog.Case, 0)
+		validators := make([]helmhog.Validator, 0, len(loadedProject.Validators))
+		for _, validator := range loadedProject.Validators {
+			if testNoApply && validator.Name() == helmhog.ValidatorApply {
+				continue
+			}
+			validators = append(validators, validator)
+		}
 
 		failedVariables := make(map[helmhog.VariableName]map[helmhog.ChoiceName]struct{}, len(loadedProject.Variables))
 		for k, v := range loadedProject.Variables {
@@ -63,9 +155,12 @@ to quickly create a Cobra application.`,
 		}
 
 		type result struct {
-			err     error
-			c       helmhog.Case
-			skipped bool
+			err      error
+			c        helmhog.Case
+			skipped  bool
+			expected bool
+			duration time.Duration
+			stages   []helmhog.StageResult
 		}
 
 		results := make(chan result)
@@ -75,47 +170,200 @@ to quickly create a Cobra application.`,
 		}
 		workerSem := make(chan struct{}, testParallel)
 
+		// runCase runs a single case, recording its stages, and returns why it failed, if it did.
+		// If ctx is done, or the case times out, its commands are killed.
+		runCase := func(ctx context.Context, c helmhog.Case, expected *helmhog.CompiledExpectedFailure, stages *helmhog.Stages) error {
+			caseCtx := ctx
+			if testCaseTimeout != 0 {
+				var cancel context.CancelFunc
+				caseCtx, cancel = context.WithTimeout(ctx, testCaseTimeout)
+				defer cancel()
+			}
+			err := loadedProject.MakeCaseTempDir(c)
+			if err != nil {
+				return errors.Wrap(err, fmt.Sprintf("create temp dir for case %v", c))
+			}
+			if expected != nil {
+				err = stages.Run(helmhog.StageExpectedFailure, func() error { return loadedProject.CheckExpectedFailure(caseCtx, c, expected) })
+			} else if testOnlyLint {
+				err = stages.Run(helmhog.ValidatorLint, func() error { return helmhog.RunContext(caseCtx, loadedProject.Lint(c)) })
+			} else if testInstall {
+				err = helmhog.RunContext(caseCtx, loadedProject.ValidateWithInstall(c, testInstallTimeout, stages))
+				if caseCtx.Err() != nil {
+					// The release may have been installed before it was killed
+					loadedProject.InstallCleanup(c, testInstallTimeout).Run()
+				}
+			} else {
+				var findings []helmhog.Finding
+				findings, err = loadedProject.RunValidators(caseCtx, c, validators, stages)
+				if err == nil {
+					err = helmhog.FindingsError(findings)
+				}
+				if err == nil && testSnapshotDir != "" {
+					err = stages.Run(helmhog.StageSnapshot, func() error { return loadedProject.CheckSnapshot(c, testSnapshotDir, testUpdateSnapshots) })
+				}
+			}
+			if err != nil && ctx.Err() == nil && errors.Is(caseCtx.Err(), context.DeadlineExceeded) {
+				err = &helmhog.CaseTimeoutError{Timeout: testCaseTimeout}
+			}
+			if testAutoRemoveSuccess {
+				os.RemoveAll(loadedProject.TempPath(c))
+				fmt.Printf("Removed %s\n", loadedProject.TempPath(c))
+			} else {
+				fmt.Printf("Not removing %s\n", loadedProject.TempPath(c))
+			}
+			if err == nil {
+				return err
+			}
+			writeErr := os.WriteFile(loadedProject.TempPath(c, "err"), []byte(err.Error()), 0600)
+			if writeErr != nil {
+				return errors.Wrap(err, fmt.Sprintf("write error file for case %v: %v", c, err))
+			}
+			return err
+		}
+
+		toCaseResult := func(result result) helmhog.CaseResult {
+			caseResult := helmhog.CaseResult{Case: result.c, Status: helmhog.CaseStatusPassed, Err: result.err, Duration: result.duration, Stages: result.stages}
+			if result.skipped {
+				caseResult.Status = helmhog.CaseStatusSkipped
+			} else if helmhog.IsCaseTimeout(result.err) {
+				caseResult.Status = helmhog.CaseStatusTimedOut
+			} else if result.err != nil {
+				caseResult.Status = helmhog.CaseStatusFailed
+			} else if result.expected {
+				caseResult.Status = helmhog.CaseStatusExpectedFailure
+			}
+			return caseResult
+		}
+
+		// runResult runs a case as part of the run, reporting it as skipped if the run is stopped before it finishes
+		runResult := func(c helmhog.Case) result {
+			start := time.Now()
+			expected := loadedProject.ExpectedFailure(c)
+			stages := new(helmhog.Stages)
+			err := runCase(runCtx, c, expected, stages)
+			if runCtx.Err() != nil {
+				// The case was killed before it finished, so it is skipped, and will be re-run by --rerun-failed
+				return result{c: c, skipped: true}
+			}
+			return result{c: c, err: err, expected: expected != nil, duration: time.Since(start), stages: stages.Results()}
+		}
+
+		// minimized are the results of the cases the minimizer ran while pruning, by case ID,
+		// which are reported instead of running those cases again if a later batch contains them
+		minimized := make(map[string]result)
+		minimizer := helmhog.Minimizer{
+			Project: loadedProject,
+			Run: func(c helmhog.Case) (string, bool) {
+				result := runResult(c)
+				if result.skipped {
+					return "", false
+				}
+				minimized[loadedProject.CaseID(c)] = result
+				return loadedProject.FailureSignature(c, result.err), true
+			},
+			Verify: testMinimizeVerify,
+			Known:  make(map[string]string),
+		}
+
+		if testPruneFailedChoices && testPrune == string(helmhog.PruneNone) {
+			testPrune = string(helmhog.PruneChoices)
+		}
+		pruning := helmhog.PruningScheduler{
+			Project:   loadedProject,
+			Mode:      helmhog.PruneMode(testPrune),
+			BatchSize: testPruneBatch,
+			KnownBad:  helmhog.NewKnownBad(loadedProject),
+			Minimizer: &minimizer,
+		}
+		err = pruning.Check()
+		if err != nil {
+			return err
+		}
+
+		// Without pruning, workers take cases as they are generated and report their results directly,
+		// otherwise, cases are passed to workers in batches, and their results are recorded before the next batch.
+		// Either way, no more cases are passed to workers once the run is stopped, and the remaining cases are reported as skipped.
+		work := make(chan helmhog.Case)
+		workResults := results
+		if pruning.Mode != helmhog.PruneNone {
+			workResults = make(chan result)
+		}
+
 		worker := func() {
 			defer func() { workerSem <- struct{}{} }()
-			for c := range cases {
-				skipped, err := func() (bool, error) {
-					if testPruneFailedChoices {
-						for k, v := range c {
-							if _, ok := failedVariables[k][v]; ok {
-								return true, nil
-							}
+			for c := range work {
+				if runCtx.Err() != nil {
+					workResults <- result{c: c, skipped: true}
+					continue
+				}
+				workResults <- runResult(c)
+			}
+		}
+
+		runStart := time.Now()
+		if pruning.Mode == helmhog.PruneNone {
+			go func() {
+				defer close(work)
+				for c := range cases {
+					select {
+					case work <- c:
+					case <-runCtx.Done():
+						results <- result{c: c, skipped: true}
+						for c := range cases {
+							results <- result{c: c, skipped: true}
 						}
+						return
 					}
-					err := loadedProject.MakeCaseTempDir(c)
-					if err != nil {
-						return false, errors.Wrap(err, fmt.Sprintf("create temp dir for case %v", c))
-					}
-					if testOnlyLint {
-						err = loadedProject.Lint(c).Run()
-					} else if testNoApply {
-						err = loadedProject.Validate(c).Run()
-					} else {
-						err = loadedProject.ValidateWithApply(c).Run()
+				}
+			}()
+		} else {
+			go func() {
+				defer close(work)
+				all := make([]helmhog.Case, 0)
+				for c := range cases {
+					all = append(all, c)
+				}
+				batches := pruning.Batches(pruning.Order(all))
+				for ix, batch := range batches {
+					if runCtx.Err() != nil {
+						for _, batch := range batches[ix:] {
+							for _, c := range batch {
+								results <- result{c: c, skipped: true}
+							}
+						}
+						return
 					}
-					if testAutoRemoveSuccess {
-						os.RemoveAll(loadedProject.TempPath(c))
-						fmt.Printf("Removed %s\n", loadedProject.TempPath(c))
-					} else {
-						fmt.Printf("Not removing %s\n", loadedProject.TempPath(c))
+					toRun := make([]helmhog.Case, 0, len(batch))
+					batchResults := make([]helmhog.CaseResult, 0, len(batch))
+					for _, c := range batch {
+						if result, ok := minimized[loadedProject.CaseID(c)]; ok {
+							batchResults = append(batchResults, toCaseResult(result))
+							results <- result
+							continue
+						}
+						if _, ok := pruning.Prune(c); ok {
+							results <- result{c: c, skipped: true}
+							continue
+						}
+						toRun = append(toRun, c)
 					}
-					if err == nil {
-						return false, err
+					go func() {
+						for _, c := range toRun {
+							work <- c
+						}
+					}()
+					for range toRun {
+						result := <-workResults
+						batchResults = append(batchResults, toCaseResult(result))
+						results <- result
 					}
-					writeErr := os.WriteFile(loadedProject.TempPath(c, "err"), []byte(err.Error()), 0600)
-					if writeErr != nil {
-						return false, errors.Wrap(err, fmt.Sprintf("write error file for case %v: %v", c, err))
+					if runCtx.Err() == nil {
+						pruning.Record(batchResults)
 					}
-					return false, err
-				}()
-				results <- result{c: c, err: err, skipped: skipped}
-			}
+				}
+			}()
 		}
-
 		for i := 0; i < testParallel; i++ {
 			go worker()
 		}
@@ -126,8 +374,11 @@ to quickly create a Cobra application.`,
 			close(results)
 		}()
 
+		caseResults := make([]helmhog.CaseResult, 0)
 		resultCount := 0
 		for result := range results {
+			caseResults = append(caseResults, toCaseResult(result))
+
 			if result.err != nil {
 				failed = append(failed, result.c)
 				for k, v := range result.c {
@@ -136,6 +387,10 @@ to quickly create a Cobra application.`,
 				if len(failed) != 0 && len(failed)%10 == 0 {
 					fmt.Printf("%d cases failed\n", len(failed))
 				}
+				if testMaxFailures != 0 && len(failed) == testMaxFailures {
+					fmt.Printf("Stopping after %d failed cases\n", len(failed))
+					cancelRun()
+				}
 			}
 			if result.skipped {
 				skipped = append(skipped, result.c)
@@ -150,7 +405,48 @@ to quickly create a Cobra application.`,
 			}
 		}
 
-		if len(failed) == 0 && len(skipped) == 0 {
+		var state *helmhog.State
+		state, err = loadedProject.NewState(projectPath, failed, skipped)
+		if err == nil {
+			err = state.Write(loadedProject.StatePath())
+		}
+		if err != nil {
+			return errors.Wrap(err, "write state file")
+		}
+		if replacedStatePath != "" {
+			os.Remove(replacedStatePath)
+			os.Remove(filepath.Dir(replacedStatePath))
+		}
+
+		if testReportJUnit != "" {
+			err = loadedProject.WriteJUnitReport(testReportJUnit, projectPath, runStart, caseResults)
+			if err != nil {
+				return errors.Wrap(err, "write JUnit report")
+			}
+			fmt.Printf("JUnit report written to %s\n", testReportJUnit)
+		}
+
+		if testReportJSON != "" {
+			var report *helmhog.JSONReport
+			report, err = loadedProject.NewJSONReport(testReportJSON, projectPath, runStart, caseResults)
+			if err == nil {
+				err = report.Write(testReportJSON)
+			}
+			if err != nil {
+				return errors.Wrap(err, "write JSON report")
+			}
+			fmt.Printf("JSON report written to %s\n", testReportJSON)
+		}
+
+		if testReportHTML != "" {
+			err = loadedProject.WriteHTMLReport(testReportHTML, projectPath, runStart, caseResults)
+			if err != nil {
+				return errors.Wrap(err, "write HTML report")
+			}
+			fmt.Printf("HTML report written to %s\n", testReportHTML)
+		}
+
+		if len(failed) == 0 && len(skipped) == 0 && interruptCtx.Err() == nil {
 			fmt.Println("All cases passed!")
 			return nil
 		}
@@ -163,13 +459,56 @@ to quickly create a Cobra application.`,
 			}
 		}
 
+		groups := loadedProject.GroupFailures(caseResults)
+		if len(groups) != 0 {
+			fmt.Println("Failed cases grouped by cause:")
+			for _, group := range groups {
+				fmt.Printf("%d cases: %s\n", len(group.Cases), group.Signature)
+				if len(group.Common) != 0 {
+					fmt.Printf("  common mappings: %s\n", loadedProject.CaseID(group.Common))
+				}
+			}
+		}
+
+		if testMinimize && len(groups) != 0 && runCtx.Err() == nil {
+			for _, result := range caseResults {
+				if result.Status != helmhog.CaseStatusSkipped {
+					minimizer.Known[loadedProject.CaseID(result.Case)] = loadedProject.FailureSignature(result.Case, result.Err)
+				}
+			}
+			fmt.Println("Minimizing failures")
+			culprits := minimizer.MinimizeAll(groups)
+			if runCtx.Err() != nil {
+				fmt.Println("Minimizing was interrupted, the minimal mappings are not known")
+			} else {
+				fmt.Println("The following minimal mappings reproduce each failure:")
+				for _, culprit := range culprits {
+					mappings := loadedProject.CaseID(culprit.Mappings)
+					if mappings == "" {
+						mappings = "(any case)"
+					}
+					fmt.Printf("%s (%d failed cases): %s\n", mappings, culprit.Failed, culprit.Signature)
+					if culprit.Total == 0 {
+						fmt.Printf("  reproduced by %d randomly chosen allowed cases containing these mappings, minimized from %s\n", culprit.Verified, describeCase(culprit.Example))
+					} else {
+						fmt.Printf("  reproduced by %d of %d allowed cases containing these mappings, minimized from %s\n", culprit.Verified, culprit.Total, describeCase(culprit.Example))
+					}
+				}
+			}
+		}
+
 		fmt.Println("The following cases failed:")
 		for _, c := range failed {
-			fmt.Println(loadedProject.TempPath(c))
+			fmt.Printf("%s %s\n", describeCase(c), loadedProject.TempPath(c))
 		}
 		fmt.Println("The following cases were skipped:")
 		for _, c := range skipped {
-			fmt.Println(loadedProject.TempPath(c))
+			fmt.Println(describeCase(c))
+		}
+		fmt.Println("Re-run a single case with --case <hash>")
+		if interruptCtx.Err() != nil {
+			err = fmt.Errorf("Interrupted!")
+			return
 		}
 		if testBatch {
 			err = fmt.Errorf("Some tests failed or were skipped!")
@@ -185,11 +524,30 @@ to quickly create a Cobra application.`,
 func init() {
 	rootCmd.AddCommand(testCmd)
 
+	addCaseFlags(testCmd)
+
 	testCmd.Flags().BoolVar(&testBatch, "batch", false, "If set, do not prompt the user for report cleanup, and return non-zero on failure")
-	testCmd.Flags().BoolVar(&testOnlyLint, "only-lint", false, "If set, do not attempt to do a helm template or kubectl apply --dry-run")
-	testCmd.Flags().BoolVar(&testNoApply, "no-apply", false, "If set, do not attempt to do a kubectl apply --dry-run, but still perform a helm template")
+	testCmd.Flags().BoolVar(&testOnlyLint, "only-lint", false, "If set, only run helm lint, and do not attempt to do a helm template or run any other validators")
+	testCmd.Flags().BoolVar(&testNoApply, "no-apply", false, "If set, do not run the apply validator, i.e. do not attempt to do a kubectl apply --dry-run, but still perform a helm template and run any other validators")
 	testCmd.Flags().IntVar(&testParallel, "parallel", 1, "Number of cases to run in parallel. Set to zero to use number of cpu cores")
 	testCmd.Flags().BoolVar(&testKeepReports, "keep-reports", false, "Do not delete reports, even if all cases pass")
-	testCmd.Flags().BoolVar(&testPruneFailedChoices, "prune-failed-choices", false, "If true, skip any cases that share any choices with any failed cases. Note this is not guarnateed for performance reasons, and a few cases may still execute.")
+	testCmd.Flags().BoolVar(&testPruneFailedChoices, "prune-failed-choices", false, "If true, skip any cases that share any choices with any failed cases. Same as --prune=choices")
+	testCmd.Flags().MarkDeprecated("prune-failed-choices", "use --prune=choices instead")
+	testCmd.Flags().StringVar(&testPrune, "prune", string(helmhog.DefaultPruneMode), fmt.Sprintf("How to skip cases which are expected to fail for an already known reason. %s runs every case. %s skips cases which share any choice with a failed case. %s skips cases containing the minimal mappings which reproduce a failure, as found by --minimize. Cases are ordered so that every choice is tried early, and run in batches of --prune-batch, with only failures from earlier batches used to skip cases, so the same cases are skipped regardless of --parallel", helmhog.PruneNone, helmhog.PruneChoices, helmhog.PruneCulprits))
+	testCmd.Flags().IntVar(&testPruneBatch, "prune-batch", helmhog.DefaultPruneBatchSize, "With --prune, the number of cases to run before updating the set of mappings known to fail. Smaller batches skip more cases, but run fewer cases in parallel")
+	testCmd.Flags().StringVar(&testRerunFailed, "rerun-failed", "", "Instead of generating cases, re-run the failed and skipped cases from the state file written to the report directory of a previous run. If no path is given, the most recent state file of this project is used, and is replaced by the state of this run")
+	testCmd.Flags().Lookup("rerun-failed").NoOptDefVal = rerunFailedLatest
+	testCmd.Flags().BoolVar(&testInstall, "install", false, "If set, instead of a kubectl apply --dry-run, install each case into its own namespace in the current kube context, wait for it to become ready, run helm test, collect resources, events, and pod logs into the report directory, then uninstall it and delete the namespace. Always uses the helm command, regardless of --engine")
+	testCmd.Flags().DurationVar(&testInstallTimeout, "install-timeout", helmhog.DefaultInstallTimeout, "How long to wait for each case to become ready, for its tests to finish, and for it to be uninstalled, when using --install")
+	testCmd.Flags().StringVar(&testSnapshotDir, "snapshot-dir", "", "If set, compare the rendered manifests of each case to its snapshot in this directory, and fail the case with a diff if they differ. Manifests are normalized according to the snapshots section of the project before comparing")
+	testCmd.Flags().BoolVar(&testUpdateSnapshots, "update-snapshots", false, "With --snapshot-dir, instead of comparing, replace the snapshot of each case with its rendered manifests")
+	testCmd.Flags().StringVar(&testReportJUnit, "report-junit", "", "If set, write a JUnit XML report of every case to this path. The reports of each case are copied next to it, into a directory with the same name, without its extension, followed by -artifacts")
+	testCmd.Flags().StringVar(&testReportJSON, "report-json", "", "If set, write a JSON report of every case, including the result of each stage and the paths to its reports, and a summary of the results of each choice, to this path. The reports of each case are copied next to it, into a directory with the same name, without its extension, followed by -artifacts")
+	testCmd.Flags().StringVar(&testReportHTML, "report-html", "", "If set, write an HTML report to this path, with the pass rate of each choice, a sortable table of every case, the output of failed cases, and links to their rendered manifests. The reports of each case are copied next to it, into a directory with the same name, without its extension, followed by -artifacts, which the links point into")
+	testCmd.Flags().BoolVar(&testMinimize, "minimize", false, "If set, for each distinct failure, search for the smallest set of mappings of a failed case which reproduces it, by re-running allowed cases which differ from it, and report them")
+	testCmd.Flags().IntVar(&testMinimizeVerify, "minimize-verify", helmhog.DefaultMinimizeVerify, "With --minimize, the maximum number of allowed cases containing each minimal set of mappings to run to check that they also fail. If there are many more, they are chosen at random")
+	testCmd.Flags().BoolVar(&testFailFast, "fail-fast", false, "If set, stop after the first failed case. Same as --max-failures=1")
+	testCmd.Flags().IntVar(&testMaxFailures, "max-failures", 0, "If not zero, stop after this many cases have failed. Running cases are killed, and are reported as skipped along with any cases which were not run")
+	testCmd.Flags().DurationVar(&testCaseTimeout, "case-timeout", 0, "If not zero, kill any case which takes longer than this, and report it as timed out. With --install, the release is still uninstalled and its namespace deleted. Cases using the sdk engine cannot be killed until rendering finishes")
 	testCmd.Flags().BoolVar(&testAutoRemoveSuccess, "auto-remove-success", false, "If true, remove output files from successful cases immediately after case completion")
 }
@@ -6,6 +6,7 @@ package cmd
 import (
 	"fmt"
 
+	"github.com/meln5674/helm-hog/pkg/helmhog"
 	"github.com/spf13/cobra"
 )
 
@@ -19,12 +20,36 @@ and usage of using your command. For example:
 Cobra is a CLI library for Go that empowers applications.
 This application is a tool to generate the needed files
 to quickly create a Cobra application.`,
-	Run: func(cmd *cobra.Command, args []string) {
-		// Project is validated for all commands, so this does nothing
-		fmt.Println("Project is valid!")
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Project is validated for all commands, so only the analysis is done here
+		warnings := loadedProject.Analyze(validateAnalysisLimit)
+		if len(warnings) == 0 {
+			fmt.Println("Project is valid!")
+			return nil
+		}
+		prefix := "Warning"
+		if validateStrict {
+			prefix = "Error"
+		}
+		for _, warning := range warnings {
+			fmt.Printf("%s: %s\n", prefix, warning)
+		}
+		if validateStrict {
+			return fmt.Errorf("Project has %d problems", len(warnings))
+		}
+		fmt.Printf("Project is valid, but has %d warnings\n", len(warnings))
+		return nil
 	},
 }
 
+var (
+	validateStrict        bool
+	validateAnalysisLimit int
+)
+
 func init() {
 	rootCmd.AddCommand(validateCmd)
+
+	validateCmd.Flags().BoolVar(&validateStrict, "strict", false, "If set, treat warnings about rules which have no effect, conflicting rules, and choices which never appear in any case as errors")
+	validateCmd.Flags().IntVar(&validateAnalysisLimit, "analysis-limit", helmhog.DefaultAnalysisLimit, "Maximum number of cases in the cartesian product of all variables to check rules and choices against. If there are more, they are not checked, and a warning is reported instead. 0 means no limit")
 }
@@ -0,0 +1,188 @@
+package helmhog
+
+import (
+	"fmt"
+	"strings"
+)
+
+type WarningKind string
+
+const (
+	// WarningKindDeadRule is a rule which does not discard any case which is not also discarded by another rule
+	WarningKindDeadRule WarningKind = "DeadRule"
+	// WarningKindSubsumedRestriction is a restriction which only discards cases which another restriction also discards.
+	// Of restrictions which discard the same cases, only those after the first in name order are reported.
+	WarningKindSubsumedRestriction WarningKind = "SubsumedRestriction"
+	// WarningKindContradictedRequirement is a requirement whose 'then' can never be satisfied due to restrictions or
+	// its own 'if', meaning that it actually discards every case matching its 'if'
+	WarningKindContradictedRequirement WarningKind = "ContradictedRequirement"
+	// WarningKindUnreachableChoice is a choice which does not appear in any allowed case
+	WarningKindUnreachableChoice WarningKind = "UnreachableChoice"
+	// WarningKindAnalysisLimit means the cartesian product was too large to analyze, so none of the other warnings were checked for
+	WarningKindAnalysisLimit WarningKind = "AnalysisLimit"
+
+	// DefaultAnalysisLimit is the default maximum number of cases in the cartesian product which are analyzed
+	DefaultAnalysisLimit = 100000
+)
+
+// A Warning is a likely mistake in a project which does not prevent it from being used
+type Warning struct {
+	Kind    WarningKind
+	Message string
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%s: %s", w.Kind, w.Message)
+}
+
+// Analyze checks every case in the cartesian product of all variables against the project's rules to find
+// rules which have no effect, restrictions which are subsumed by other restrictions, requirements which are
+// contradicted by restrictions, and choices which cannot appear in any allowed case.
+// If the product has more than limit cases, it is not walked, and only a warning saying so is returned. A limit of 0 means no limit.
+func (l *LoadedProject) Analyze(limit int) []Warning {
+	if limit != 0 {
+		size := 1
+		for _, choices := range l.Variables {
+			size *= len(choices)
+			if size > limit {
+				return []Warning{{
+					Kind:    WarningKindAnalysisLimit,
+					Message: fmt.Sprintf("Rules were not analyzed because there are more than %d cases in the cartesian product of all variables", limit),
+				}}
+			}
+		}
+	}
+
+	rules := l.Rules()
+
+	// How many cases each rule discards, and how many cases it is the only rule to discard
+	discards := make([]int, len(rules))
+	soleDiscards := make([]int, len(rules))
+	// For each restriction, the set of other restrictions which discard every case it discards
+	subsumedBy := make([]map[int]struct{}, len(rules))
+	// For each requirement, how many cases match its 'if', how many of those also match its 'then',
+	// and how many of those are not discarded by any restriction
+	ifMatches := make([]int, len(rules))
+	thenMatches := make([]int, len(rules))
+	satisfiable := make([]int, len(rules))
+	for ix, rule := range rules {
+		if rule.Kind != RuleKindRestriction {
+			continue
+		}
+		subsumedBy[ix] = make(map[int]struct{})
+		for other, otherRule := range rules {
+			if other != ix && otherRule.Kind == RuleKindRestriction {
+				subsumedBy[ix][other] = struct{}{}
+			}
+		}
+	}
+	reachable := make(map[VariableName]map[ChoiceName]struct{}, len(l.Variables))
+	for name := range l.Variables {
+		reachable[name] = make(map[ChoiceName]struct{})
+	}
+
+	cases := make(chan Case)
+	go l.generateProduct(cases, func(Case) bool { return true })
+	discarded := make([]bool, len(rules))
+	for c := range cases {
+		discardCount := 0
+		discardedByRestriction := false
+		for ix, rule := range rules {
+			discarded[ix] = !rule.Allows(c)
+			if discarded[ix] {
+				discardCount++
+				discards[ix]++
+				if rule.Kind == RuleKindRestriction {
+					discardedByRestriction = true
+				}
+			}
+		}
+		if discardCount == 0 {
+			for name, choice := range c {
+				reachable[name][choice] = struct{}{}
+			}
+		}
+		for ix, rule := range rules {
+			if discarded[ix] && discardCount == 1 {
+				soleDiscards[ix]++
+			}
+			if discarded[ix] && subsumedBy[ix] != nil {
+				for other := range subsumedBy[ix] {
+					if !discarded[other] {
+						delete(subsumedBy[ix], other)
+					}
+				}
+			}
+			if req, ok := rule.Rule.(*Requirement); ok && req.If.Matches(c) {
+				ifMatches[ix]++
+				if req.Then.Matches(c) {
+					thenMatches[ix]++
+					if !discardedByRestriction {
+						satisfiable[ix]++
+					}
+				}
+			}
+		}
+	}
+
+	warnings := make([]Warning, 0)
+	for ix, rule := range rules {
+		if ifMatches[ix] != 0 && thenMatches[ix] == 0 {
+			warnings = append(warnings, Warning{
+				Kind:    WarningKindContradictedRequirement,
+				Message: fmt.Sprintf("%s can never be satisfied because no case matches both its 'if' and its 'then', so every case matching its 'if' is discarded", rule),
+			})
+		} else if ifMatches[ix] != 0 && satisfiable[ix] == 0 {
+			warnings = append(warnings, Warning{
+				Kind:    WarningKindContradictedRequirement,
+				Message: fmt.Sprintf("%s can never be satisfied because every case matching its 'then' is discarded by restrictions, so every case matching its 'if' is discarded", rule),
+			})
+		}
+		if discards[ix] == 0 {
+			warnings = append(warnings, Warning{
+				Kind:    WarningKindDeadRule,
+				Message: fmt.Sprintf("%s never discards any case", rule),
+			})
+			continue
+		}
+		if len(subsumedBy[ix]) != 0 {
+			// Restrictions which subsume each other discard the same cases, so only the later one is reported,
+			// otherwise, removing both as suggested would lose the restriction entirely
+			others := make([]string, 0, len(subsumedBy[ix]))
+			for other := range rules {
+				if _, ok := subsumedBy[ix][other]; !ok {
+					continue
+				}
+				if _, mutual := subsumedBy[other][ix]; mutual && other > ix {
+					continue
+				}
+				others = append(others, string(rules[other].Name))
+			}
+			if len(others) == 0 {
+				continue
+			}
+			warnings = append(warnings, Warning{
+				Kind:    WarningKindSubsumedRestriction,
+				Message: fmt.Sprintf("%s only discards cases which are also discarded by Restriction(s) %s", rule, strings.Join(others, ", ")),
+			})
+			continue
+		}
+		if soleDiscards[ix] == 0 {
+			warnings = append(warnings, Warning{
+				Kind:    WarningKindDeadRule,
+				Message: fmt.Sprintf("%s only discards cases which are also discarded by other rules", rule),
+			})
+		}
+	}
+	for _, name := range l.VariableOrder {
+		for _, choice := range l.ChoiceOrder[name] {
+			if _, ok := reachable[name][choice]; !ok {
+				warnings = append(warnings, Warning{
+					Kind:    WarningKindUnreachableChoice,
+					Message: fmt.Sprintf("Variable %s, Choice %s does not appear in any allowed case", name, choice),
+				})
+			}
+		}
+	}
+	return warnings
+}
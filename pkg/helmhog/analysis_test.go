@@ -0,0 +1,126 @@
+package helmhog
+
+import (
+	"strings"
+	"testing"
+)
+
+const analysisTestProject = `
+apiVersion: helm-hog.meln5674.github.com/v1alpha1
+kind: Project
+parts:
+  p: {}
+variables:
+  db: {postgres: [p], mysql: [p], none: [p]}
+  replicas: {one: [p], many: [p]}
+  tls: {disabled: [p], enabled: [p]}
+`
+
+func TestAnalyze(t *testing.T) {
+	tests := []struct {
+		name     string
+		rules    string
+		limit    int
+		warnings []string
+	}{
+		{
+			name: "no warnings",
+			rules: `
+requirements:
+  many-replicas-need-db: {if: {replicas: many}, then: {db: [postgres, mysql]}}
+restrictions:
+  no-tls-without-db: {db: none, tls: enabled}
+`,
+		},
+		{
+			name: "rule matching no case",
+			rules: `
+conditions:
+  always: 'case.db != "none" || case.tls == "enabled" || case.tls == "disabled"'
+`,
+			warnings: []string{"DeadRule: Condition always never discards any case"},
+		},
+		{
+			name: "rule covered by other rules",
+			rules: `
+restrictions:
+  no-mysql-with-tls: {db: mysql, tls: enabled}
+  no-postgres-with-tls: {db: postgres, tls: enabled}
+conditions:
+  no-db-with-tls-and-many-replicas: '!(case.db != "none" && case.tls == "enabled" && case.replicas == "many")'
+`,
+			warnings: []string{"DeadRule: Condition no-db-with-tls-and-many-replicas only discards cases which are also discarded by other rules"},
+		},
+		{
+			name: "subsumed restriction",
+			rules: `
+restrictions:
+  no-mysql-with-tls: {db: mysql, tls: enabled}
+  no-mysql-with-tls-and-many-replicas: {db: mysql, tls: enabled, replicas: many}
+`,
+			warnings: []string{"SubsumedRestriction: Restriction no-mysql-with-tls-and-many-replicas only discards cases which are also discarded by Restriction(s) no-mysql-with-tls"},
+		},
+		{
+			name: "identical restrictions",
+			rules: `
+restrictions:
+  a-no-mysql-with-tls: {db: mysql, tls: enabled}
+  b-no-mysql-with-tls: {tls: enabled, db: mysql}
+  c-no-mysql-with-tls: {db: [mysql], tls: [enabled]}
+`,
+			// Only the later restrictions are reported, so removing them keeps the first
+			warnings: []string{
+				"SubsumedRestriction: Restriction b-no-mysql-with-tls only discards cases which are also discarded by Restriction(s) a-no-mysql-with-tls",
+				"SubsumedRestriction: Restriction c-no-mysql-with-tls only discards cases which are also discarded by Restriction(s) a-no-mysql-with-tls, b-no-mysql-with-tls",
+			},
+		},
+		{
+			name: "requirement contradicted by itself",
+			rules: `
+requirements:
+  many-replicas-need-one: {if: {replicas: many}, then: {replicas: one}}
+`,
+			warnings: []string{
+				"ContradictedRequirement: Requirement many-replicas-need-one can never be satisfied because no case matches both its 'if' and its 'then', so every case matching its 'if' is discarded",
+				"UnreachableChoice: Variable replicas, Choice many does not appear in any allowed case",
+			},
+		},
+		{
+			name: "requirement contradicted by restriction",
+			rules: `
+requirements:
+  tls-needs-db: {if: {tls: enabled}, then: {db: postgres}}
+restrictions:
+  no-postgres: {db: postgres}
+`,
+			warnings: []string{
+				"ContradictedRequirement: Requirement tls-needs-db can never be satisfied because every case matching its 'then' is discarded by restrictions, so every case matching its 'if' is discarded",
+				"UnreachableChoice: Variable db, Choice postgres does not appear in any allowed case",
+				"UnreachableChoice: Variable tls, Choice enabled does not appear in any allowed case",
+			},
+		},
+		{
+			name:     "too many cases",
+			rules:    "restrictions: {no-mysql: {db: mysql}, also-no-mysql: {db: mysql}}\n",
+			limit:    11,
+			warnings: []string{"AnalysisLimit: Rules were not analyzed because there are more than 11 cases in the cartesian product of all variables"},
+		},
+		{
+			name:  "exactly the limit",
+			rules: "restrictions: {no-mysql-with-tls: {db: mysql, tls: enabled}}\n",
+			limit: 12,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l := loadTestProject(t, analysisTestProject+test.rules)
+			warnings := make([]string, 0)
+			for _, warning := range l.Analyze(test.limit) {
+				warnings = append(warnings, warning.String())
+			}
+			if strings.Join(warnings, "\n") != strings.Join(test.warnings, "\n") {
+				t.Errorf("Got warnings:\n%s\nwant:\n%s", strings.Join(warnings, "\n"), strings.Join(test.warnings, "\n"))
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package helmhog
+
+import (
+	"path/filepath"
+
+	"github.com/meln5674/gosh"
+)
+
+type ApplyMode string
+
+const (
+	// ApplyModeClient validates rendered manifests with kubectl apply --dry-run=client
+	ApplyModeClient ApplyMode = "client"
+	// ApplyModeSchema validates rendered manifests against JSON schemas from a local directory and the project's CRDs,
+	// without kubectl or a cluster
+	ApplyModeSchema ApplyMode = "schema"
+	// ApplyModeServer validates rendered manifests with kubectl apply --dry-run=server against the current kube context,
+	// in a namespace which is created for each case, and deleted afterwards
+	ApplyModeServer ApplyMode = "server"
+
+	DefaultApplyMode = ApplyModeClient
+)
+
+// CaseNamespace returns the namespace dedicated to a case when it is applied to or installed in a cluster.
+// Namespaces are unique to both the case and this run, so that concurrent runs against the same cluster do not conflict.
+func (l *LoadedProject) CaseNamespace(c Case) string {
+	return filepath.Base(l.TempDir) + "-" + l.CaseHash(c)
+}
+
+// renderNamespace returns the namespace to render a case in, or an empty string to use the default
+func (l *LoadedProject) renderNamespace(c Case) string {
+	if l.Settings.ApplyMode != ApplyModeServer {
+		return ""
+	}
+	return l.CaseNamespace(c)
+}
+
+// apply validates rendered manifests from stdin with kubectl. ApplyModeSchema does not use kubectl, see validateSchemaFindings.
+func (l *LoadedProject) apply(c Case) gosh.Pipelineable {
+	var apply gosh.Pipelineable
+	switch l.Settings.ApplyMode {
+	case ApplyModeServer:
+		cmd := []string{"kubectl", "apply", "-f", "-", "--dry-run=server", "--namespace", l.CaseNamespace(c)}
+		cmd = append(cmd, l.Settings.KubectlFlags...)
+		apply = gosh.Command(cmd...)
+	default:
+		cmd := []string{"kubectl", "apply", "-f", "-", "--dry-run=client"}
+		cmd = append(cmd, l.Settings.KubectlFlags...)
+		apply = gosh.Command(cmd...)
+	}
+	gosh.FileOut(l.ApplyOutPath(c))(apply)
+	gosh.FileErr(l.ApplyErrPath(c))(apply)
+	return apply
+}
+
+// inCaseNamespace creates the namespace of a case, runs a command, then deletes the namespace, even if the command failed.
+// The first error, if any, is returned.
+func (l *LoadedProject) inCaseNamespace(c Case, cmd gosh.Commander) gosh.Commander {
+	create := []string{"kubectl", "create", "namespace", l.CaseNamespace(c)}
+	create = append(create, l.Settings.KubectlFlags...)
+	return gosh.Sequence(
+		func(s *gosh.SequenceCmd, ix int, err error, killed bool) (bool, error) {
+			// There is nothing to delete if the namespace was not created
+			if ix == 0 {
+				return err == nil && !killed, err
+			}
+			return firstError(s, ix, err, killed)
+		},
+		gosh.Command(create...).WithStreams(gosh.FileOut(l.CreateNamespaceOutPath(c)), gosh.FileErr(l.CreateNamespaceErrPath(c))),
+		cmd,
+		l.deleteCaseNamespace(c),
+	)
+}
+
+// deleteCaseNamespace deletes the namespace of a case
+func (l *LoadedProject) deleteCaseNamespace(c Case) gosh.Commander {
+	// Don't wait for the contents of the namespace to be removed, the case is already done with it
+	delete := []string{"kubectl", "delete", "namespace", l.CaseNamespace(c), "--wait=false"}
+	delete = append(delete, l.Settings.KubectlFlags...)
+	return gosh.Command(delete...).WithStreams(gosh.FileOut(l.DeleteNamespaceOutPath(c)), gosh.FileErr(l.DeleteNamespaceErrPath(c)))
+}
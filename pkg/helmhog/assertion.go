@@ -0,0 +1,256 @@
+package helmhog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+	"github.com/pkg/errors"
+	"k8s.io/client-go/util/jsonpath"
+	"sigs.k8s.io/yaml"
+)
+
+type AssertionName = string
+
+const (
+	// ValidatorAssertions checks the project's assertions against the rendered manifests of a case
+	ValidatorAssertions ValidatorName = "assertions"
+
+	// AssertionObjectVariable is the name of the variable which holds the object being checked by a CEL assertion
+	AssertionObjectVariable = "object"
+)
+
+// An ObjectSelector matches rendered objects by their apiVersion, kind, name, and labels.
+// Fields which are not set match any object.
+type ObjectSelector struct {
+	APIVersion string            `json:"apiVersion,omitempty"`
+	Kind       string            `json:"kind,omitempty"`
+	Name       string            `json:"name,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+}
+
+func (s *ObjectSelector) Matches(obj *schemaObject) bool {
+	if s.APIVersion != "" && s.APIVersion != obj.APIVersion {
+		return false
+	}
+	if s.Kind != "" && s.Kind != obj.Kind {
+		return false
+	}
+	if s.Name != "" && s.Name != obj.Metadata.Name {
+		return false
+	}
+	for k, v := range s.Labels {
+		if actual, ok := obj.Metadata.Labels[k]; !ok || actual != v {
+			return false
+		}
+	}
+	return true
+}
+
+// An Assertion is a check that every rendered object matching a selector satisfies either a JSONPath, which must find
+// at least one value which is not null, false, or empty, or a CEL expression, which must evaluate to true.
+// If a "when" condition is provided, the assertion only applies to cases matching it.
+// Unless the assertion is optional, at least one object must match the selector.
+type Assertion struct {
+	When     Condition      `json:"when,omitempty"`
+	Select   ObjectSelector `json:"select"`
+	JSONPath string         `json:"jsonPath,omitempty"`
+	CEL      string         `json:"cel,omitempty"`
+	Optional bool           `json:"optional,omitempty"`
+}
+
+// A CompiledAssertion is an Assertion whose JSONPath or CEL expression has been checked and compiled
+type CompiledAssertion struct {
+	*Assertion
+	Name    AssertionName
+	program cel.Program
+	// jsonPath keeps state while finding results, so it is locked, as the same assertion is checked by every case
+	jsonPath     *jsonpath.JSONPath
+	jsonPathLock sync.Mutex
+}
+
+// CompileAssertion checks that an assertion only refers to variables and choices that exist in the project,
+// and compiles its JSONPath or CEL expression
+func CompileAssertion(p *Project, name AssertionName, a *Assertion) (*CompiledAssertion, error) {
+	compiled := CompiledAssertion{Assertion: a, Name: name}
+	err := a.When.Check(p)
+	if err != nil {
+		return nil, errors.Wrap(err, "when")
+	}
+	if (a.JSONPath == "") == (a.CEL == "") {
+		return nil, fmt.Errorf("Exactly one of jsonPath or cel must be provided")
+	}
+	if a.JSONPath != "" {
+		compiled.jsonPath = jsonpath.New(name).AllowMissingKeys(true)
+		err = compiled.jsonPath.Parse(a.JSONPath)
+		if err != nil {
+			return nil, errors.Wrap(err, "jsonPath")
+		}
+		return &compiled, nil
+	}
+	env, err := cel.NewEnv(
+		cel.Variable(AssertionObjectVariable, cel.DynType),
+		cel.Variable(ExpressionCaseVariable, cel.MapType(cel.StringType, cel.StringType)),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "create CEL environment")
+	}
+	ast, iss := env.Compile(a.CEL)
+	if iss.Err() != nil {
+		return nil, errors.Wrap(iss.Err(), "cel")
+	}
+	if ast.OutputType() != cel.BoolType {
+		return nil, fmt.Errorf("cel: Expression must evaluate to a bool, not %v", ast.OutputType())
+	}
+	checked, err := cel.AstToCheckedExpr(ast)
+	if err != nil {
+		return nil, errors.Wrap(err, "cel")
+	}
+	err = checkExpression(p, checked.Expr, make(map[VariableName]struct{}))
+	if err != nil {
+		return nil, errors.Wrap(err, "cel")
+	}
+	compiled.program, err = env.Program(ast)
+	if err != nil {
+		return nil, errors.Wrap(err, "cel")
+	}
+	return &compiled, nil
+}
+
+// truthy returns false for values which are null, false, or empty
+func truthy(v reflect.Value) bool {
+	for v.IsValid() && (v.Kind() == reflect.Interface || v.Kind() == reflect.Pointer) {
+		if v.IsNil() {
+			return false
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return false
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.String, reflect.Map, reflect.Slice, reflect.Array:
+		return v.Len() != 0
+	}
+	return true
+}
+
+// check returns an error describing why an object does not satisfy the assertion, or nil if it does
+func (a *CompiledAssertion) check(c Case, obj map[string]interface{}) error {
+	if a.jsonPath != nil {
+		a.jsonPathLock.Lock()
+		results, err := a.jsonPath.FindResults(obj)
+		a.jsonPathLock.Unlock()
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("jsonPath %s", a.JSONPath))
+		}
+		for _, result := range results {
+			for _, value := range result {
+				if truthy(value) {
+					return nil
+				}
+			}
+		}
+		return fmt.Errorf("jsonPath %s did not find any value which is not null, false, or empty", a.JSONPath)
+	}
+	out, _, err := a.program.Eval(map[string]interface{}{
+		AssertionObjectVariable: obj,
+		ExpressionCaseVariable:  map[string]string(c),
+	})
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("cel %s", a.CEL))
+	}
+	if allowed, ok := out.Value().(bool); !ok || !allowed {
+		return fmt.Errorf("cel %s is false", a.CEL)
+	}
+	return nil
+}
+
+// CheckAssertions checks every assertion which applies to a case against its rendered manifests,
+// returning a finding for each object which does not satisfy an assertion, and for each non-optional assertion
+// which no object matched.
+func (l *LoadedProject) CheckAssertions(c Case, manifests []byte) ([]Finding, error) {
+	docs, err := readDocuments(bytes.NewReader(manifests))
+	if err != nil {
+		return nil, errors.Wrap(err, "read manifests")
+	}
+	type object struct {
+		meta  schemaObject
+		value map[string]interface{}
+	}
+	objects := make([]object, 0, len(docs))
+	for ix, doc := range docs {
+		var obj object
+		err = yaml.Unmarshal(doc, &obj.meta)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("parse document %d", ix))
+		}
+		err = yaml.Unmarshal(doc, &obj.value)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("parse document %d", ix))
+		}
+		objects = append(objects, obj)
+	}
+
+	names := make([]AssertionName, 0, len(l.Assertions))
+	for name := range l.Assertions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	findings := make([]Finding, 0)
+	for _, name := range names {
+		assertion := l.Assertions[name]
+		if !assertion.When.Matches(c) {
+			continue
+		}
+		matched := 0
+		for ix := range objects {
+			obj := &objects[ix]
+			if !assertion.Select.Matches(&obj.meta) {
+				continue
+			}
+			matched++
+			err := assertion.check(c, obj.value)
+			if err != nil {
+				findings = append(findings, Finding{
+					Validator: ValidatorAssertions,
+					Object:    obj.meta.String(),
+					Message:   fmt.Sprintf("Assertion %s failed: %v", name, err),
+				})
+			}
+		}
+		if matched == 0 && !assertion.Optional {
+			findings = append(findings, Finding{
+				Validator: ValidatorAssertions,
+				Message:   fmt.Sprintf("Assertion %s failed: no object matched its selector", name),
+			})
+		}
+	}
+	return findings, nil
+}
+
+// assertionsValidator checks the project's assertions
+type assertionsValidator struct{}
+
+func (assertionsValidator) Name() ValidatorName {
+	return ValidatorAssertions
+}
+
+func (assertionsValidator) NeedsManifests() bool {
+	return true
+}
+
+func (assertionsValidator) Validate(ctx context.Context, in *ValidationInput) ([]Finding, error) {
+	return in.Project.CheckAssertions(in.Case, in.Manifests)
+}
+
+func init() {
+	RegisterValidator(ValidatorAssertions, func(*LoadedProject) (Validator, error) { return assertionsValidator{}, nil })
+}
@@ -0,0 +1,188 @@
+package helmhog
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+const assertionTestProject = `
+apiVersion: helm-hog.meln5674.github.com/v1alpha1
+kind: Project
+parts:
+  p: {}
+variables:
+  tls: {disabled: [p], enabled: [p]}
+  replicas: {one: [p], many: [p]}
+`
+
+const assertionTestManifests = `
+apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: web
+  labels: {app: web}
+spec:
+  tls: []
+  rules: [{host: example.com}]
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  labels: {app: web, tier: frontend}
+spec:
+  replicas: 3
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: db
+  labels: {app: db}
+spec:
+  replicas: 1
+`
+
+func TestCheckAssertions(t *testing.T) {
+	c := Case{"tls": "enabled", "replicas": "many"}
+	tests := []struct {
+		name      string
+		assertion string
+		c         Case
+		// findings are the objects and messages of the findings, or empty if the assertion passes
+		findings []string
+	}{
+		{
+			name:      "jsonPath match",
+			assertion: `{select: {kind: Ingress}, jsonPath: '{.spec.rules[*].host}'}`,
+		},
+		{
+			name:      "jsonPath mismatch",
+			assertion: `{select: {kind: Ingress}, jsonPath: '{.spec.tls}'}`,
+			findings:  []string{"Ingress web (networking.k8s.io/v1): Assertion test failed: jsonPath {.spec.tls} did not find any value which is not null, false, or empty"},
+		},
+		{
+			name:      "jsonPath missing key",
+			assertion: `{select: {kind: Deployment}, jsonPath: '{.spec.strategy}'}`,
+			findings: []string{
+				"Deployment web (apps/v1): Assertion test failed: jsonPath {.spec.strategy} did not find any value which is not null, false, or empty",
+				"Deployment db (apps/v1): Assertion test failed: jsonPath {.spec.strategy} did not find any value which is not null, false, or empty",
+			},
+		},
+		{
+			name:      "cel match by label",
+			assertion: `{select: {kind: Deployment, labels: {app: db}}, cel: 'object.spec.replicas == 1'}`,
+		},
+		{
+			name:      "cel mismatch",
+			assertion: `{select: {apiVersion: apps/v1, kind: Deployment}, cel: 'case.replicas == "many" || object.spec.replicas == 1'}`,
+			c:         Case{"tls": "enabled", "replicas": "one"},
+			findings:  []string{`Deployment web (apps/v1): Assertion test failed: cel case.replicas == "many" || object.spec.replicas == 1 is false`},
+		},
+		{
+			name:      "cel uses case",
+			assertion: `{select: {apiVersion: apps/v1, kind: Deployment}, cel: 'case.replicas == "many" || object.spec.replicas == 1'}`,
+		},
+		{
+			name:      "cel evaluation error",
+			assertion: `{select: {name: db}, cel: 'object.spec.paused == false'}`,
+			findings:  []string{"Deployment db (apps/v1): Assertion test failed: cel object.spec.paused == false: no such key: paused"},
+		},
+		{
+			name:      "no matching objects",
+			assertion: `{select: {kind: StatefulSet}, cel: 'true'}`,
+			findings:  []string{"Assertion test failed: no object matched its selector"},
+		},
+		{
+			name:      "optional with no matching objects",
+			assertion: `{select: {kind: StatefulSet}, cel: 'false', optional: true}`,
+		},
+		{
+			name:      "labels must all match",
+			assertion: `{select: {labels: {app: web, tier: backend}}, cel: 'false', optional: true}`,
+		},
+		{
+			name:      "when is false",
+			assertion: `{when: {tls: disabled}, select: {kind: Ingress}, jsonPath: '{.spec.tls}'}`,
+		},
+		{
+			name:      "when is true",
+			assertion: `{when: {tls: enabled}, select: {kind: Ingress}, cel: 'has(object.spec.tls) && size(object.spec.tls) != 0'}`,
+			findings:  []string{`Ingress web (networking.k8s.io/v1): Assertion test failed: cel has(object.spec.tls) && size(object.spec.tls) != 0 is false`},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l := loadTestProject(t, assertionTestProject+"assertions: {test: "+test.assertion+"}\n")
+			testCase := test.c
+			if testCase == nil {
+				testCase = c
+			}
+			findings, err := l.CheckAssertions(testCase, []byte(assertionTestManifests))
+			if err != nil {
+				t.Fatal(err)
+			}
+			messages := make([]string, 0, len(findings))
+			for _, finding := range findings {
+				if finding.Validator != ValidatorAssertions {
+					t.Errorf("Finding %s is not from the %s validator", finding, ValidatorAssertions)
+				}
+				if finding.Object != "" {
+					messages = append(messages, finding.Object+": "+finding.Message)
+				} else {
+					messages = append(messages, finding.Message)
+				}
+			}
+			if strings.Join(messages, "\n") != strings.Join(test.findings, "\n") {
+				t.Errorf("Got findings:\n%s\nwant:\n%s", strings.Join(messages, "\n"), strings.Join(test.findings, "\n"))
+			}
+		})
+	}
+}
+
+func TestCheckAssertionsConcurrently(t *testing.T) {
+	l := loadTestProject(t, assertionTestProject+"assertions: {tls: {select: {kind: Ingress}, jsonPath: '{.spec.rules[*].host}'}}\n")
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			findings, err := l.CheckAssertions(Case{"tls": "enabled", "replicas": "one"}, []byte(assertionTestManifests))
+			if err != nil || len(findings) != 0 {
+				t.Errorf("CheckAssertions() = %v, %v", findings, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestCompileAssertionErrors(t *testing.T) {
+	l := loadTestProject(t, assertionTestProject)
+	tests := []struct {
+		assertion string
+		err       string
+	}{
+		{assertion: `{select: {kind: Ingress}}`, err: "Exactly one of jsonPath or cel must be provided"},
+		{assertion: `{select: {kind: Ingress}, jsonPath: '{.spec}', cel: 'true'}`, err: "Exactly one of jsonPath or cel must be provided"},
+		{assertion: `{select: {kind: Ingress}, jsonPath: '{.spec'}`, err: "jsonPath: unclosed action"},
+		{assertion: `{select: {kind: Ingress}, cel: 'object.spec.tls =='}`, err: "cel: ERROR"},
+		{assertion: `{select: {kind: Ingress}, cel: '"tls"'}`, err: "cel: Expression must evaluate to a bool"},
+		{assertion: `{select: {kind: Ingress}, cel: 'case.ingress == "nginx"'}`, err: "cel: Undefined variable ingress"},
+		{assertion: `{select: {kind: Ingress}, cel: 'case.tls == "on"'}`, err: "cel: Variable tls has no choice on"},
+		{assertion: `{select: {kind: Ingress}, cel: 'true', when: {tls: maybe}}`, err: "when: Variable tls has no choice maybe"},
+	}
+	for _, test := range tests {
+		t.Run(test.assertion, func(t *testing.T) {
+			var assertion Assertion
+			err := yaml.Unmarshal([]byte(test.assertion), &assertion)
+			if err == nil {
+				_, err = CompileAssertion(l.Project, "test", &assertion)
+			}
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("expected error containing %q, got %v", test.err, err)
+			}
+		})
+	}
+}
@@ -1,5 +1,15 @@
 package helmhog
 
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
 type MappingSet map[VariableName]ChoiceName
 
 type Case MappingSet
@@ -12,3 +22,109 @@ func (c Case) With(name VariableName, choice ChoiceName) Case {
 	newC[name] = choice
 	return newC
 }
+
+// Maps returns true if c has a mapping for every one of the named variables
+func (c Case) Maps(names ...VariableName) bool {
+	for _, name := range names {
+		if _, ok := c[name]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+const (
+	caseIDSeparator       = ","
+	caseIDMappingOperator = "="
+	caseHashLength        = 10
+)
+
+// CaseID returns the canonical ID of a case, which is its mappings in VariableOrder, e.g. var1=a,var2=b
+func (l *LoadedProject) CaseID(c Case) string {
+	mappings := make([]string, 0, len(l.VariableOrder))
+	for _, name := range l.VariableOrder {
+		choice, ok := c[name]
+		if !ok {
+			continue
+		}
+		mappings = append(mappings, name+caseIDMappingOperator+choice)
+	}
+	return strings.Join(mappings, caseIDSeparator)
+}
+
+// CaseHash returns a short hash of the mappings of a case. Unlike the case ID, it does not depend on VariableOrder.
+func (l *LoadedProject) CaseHash(c Case) string {
+	names := make([]VariableName, 0, len(c))
+	for name := range c {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	hash := sha256.New()
+	for _, name := range names {
+		fmt.Fprintf(hash, "%s%s%s\n", name, caseIDMappingOperator, c[name])
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:caseHashLength]
+}
+
+// ParseCaseID parses a case ID produced by CaseID, checking that it has a valid mapping for every variable
+func (l *LoadedProject) ParseCaseID(id string) (Case, error) {
+	c, err := l.ParsePartialCaseID(id)
+	if err != nil {
+		return nil, err
+	}
+	for name := range l.Variables {
+		if _, ok := c[name]; !ok {
+			return nil, fmt.Errorf("Variable %s is not mapped", name)
+		}
+	}
+	return c, nil
+}
+
+// ParsePartialCaseID is like ParseCaseID, but allows variables to not be mapped, producing a partial case
+func (l *LoadedProject) ParsePartialCaseID(id string) (Case, error) {
+	c := make(Case, len(l.Variables))
+	for _, mapping := range strings.Split(id, caseIDSeparator) {
+		name, choice, ok := strings.Cut(mapping, caseIDMappingOperator)
+		if !ok {
+			return nil, fmt.Errorf("Invalid mapping %s, expected variable%schoice", mapping, caseIDMappingOperator)
+		}
+		if _, ok := l.Variables[name]; !ok {
+			return nil, fmt.Errorf("Undefined variable %s", name)
+		}
+		if _, ok := l.Variables[name][choice]; !ok {
+			return nil, fmt.Errorf("Variable %s has no choice %s", name, choice)
+		}
+		if _, ok := c[name]; ok {
+			return nil, fmt.Errorf("Variable %s is mapped more than once", name)
+		}
+		c[name] = choice
+	}
+	return c, nil
+}
+
+// ResolveCase finds the case referred to by either a case ID or a case hash, and checks that it is allowed
+func (l *LoadedProject) ResolveCase(ref string) (Case, error) {
+	if strings.Contains(ref, caseIDMappingOperator) {
+		c, err := l.ParseCaseID(ref)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("parse case ID %s", ref))
+		}
+		if !l.Allows(c) {
+			return nil, fmt.Errorf("Case %s is not allowed by the project's rules", ref)
+		}
+		return c, nil
+	}
+
+	cases := make(chan Case)
+	go l.generateExhaustive(cases)
+	var found Case
+	for c := range cases {
+		if found == nil && l.CaseHash(c) == ref {
+			found = c
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("No allowed case has hash %s", ref)
+	}
+	return found, nil
+}
@@ -0,0 +1,135 @@
+package helmhog
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCaseIDRoundTrip(t *testing.T) {
+	for _, order := range []string{"", "variableOrder: [ingress, db]\n"} {
+		l := loadTestProject(t, selectorTestProject+order)
+		cases := make(chan Case)
+		go l.generateProduct(cases, func(Case) bool { return true })
+		hashes := make(map[string]string)
+		for c := range cases {
+			id := l.CaseID(c)
+			parsed, err := l.ParseCaseID(id)
+			if err != nil {
+				t.Fatalf("ParseCaseID(%s): %v", id, err)
+			}
+			if l.CaseID(parsed) != id || len(parsed) != len(c) {
+				t.Errorf("ParseCaseID(%s) = %v, want %v", id, parsed, c)
+			}
+			hash := l.CaseHash(c)
+			if len(hash) != caseHashLength {
+				t.Errorf("CaseHash(%s) = %s, want %d characters", id, hash, caseHashLength)
+			}
+			if other, ok := hashes[hash]; ok {
+				t.Errorf("Cases %s and %s have the same hash %s", id, other, hash)
+			}
+			hashes[hash] = id
+		}
+		if len(hashes) != 6 {
+			t.Errorf("Got %d cases, want 6", len(hashes))
+		}
+	}
+
+	// The ID depends on the variable order, but the hash does not
+	c := Case{"db": "mysql", "ingress": "nginx"}
+	l := loadTestProject(t, selectorTestProject)
+	reordered := loadTestProject(t, selectorTestProject+"variableOrder: [ingress, db]\n")
+	if l.CaseID(c) != "db=mysql,ingress=nginx" || reordered.CaseID(c) != "ingress=nginx,db=mysql" {
+		t.Errorf("Got case IDs %s and %s", l.CaseID(c), reordered.CaseID(c))
+	}
+	if l.CaseHash(c) != reordered.CaseHash(c) {
+		t.Errorf("Hash %s changed to %s when variables were reordered", l.CaseHash(c), reordered.CaseHash(c))
+	}
+	parsed, err := reordered.ParseCaseID(l.CaseID(c))
+	if err != nil || reordered.CaseID(parsed) != reordered.CaseID(c) {
+		t.Errorf("ParseCaseID(%s) = %v, %v", l.CaseID(c), parsed, err)
+	}
+}
+
+func TestParseCaseIDErrors(t *testing.T) {
+	l := loadTestProject(t, selectorTestProject)
+	tests := []struct {
+		id      string
+		partial bool
+		err     string
+	}{
+		{id: "db=mysql", err: "Variable ingress is not mapped"},
+		{id: "db=mysql,ingress=nginx,cache=redis", err: "Undefined variable cache"},
+		{id: "db=sqlite,ingress=nginx", err: "Variable db has no choice sqlite"},
+		{id: "db=mysql,ingress=nginx,db=postgres", err: "Variable db is mapped more than once"},
+		{id: "db=mysql,ingress=nginx,db=mysql", err: "Variable db is mapped more than once"},
+		{id: "db=mysql,nginx", err: "Invalid mapping nginx, expected variable=choice"},
+		{id: "", err: "Invalid mapping , expected variable=choice"},
+		{id: "db=mysql,db=none", partial: true, err: "Variable db is mapped more than once"},
+		{id: "cache=redis", partial: true, err: "Undefined variable cache"},
+	}
+	for _, test := range tests {
+		t.Run(test.id, func(t *testing.T) {
+			var err error
+			if test.partial {
+				_, err = l.ParsePartialCaseID(test.id)
+			} else {
+				_, err = l.ParseCaseID(test.id)
+			}
+			if err == nil || err.Error() != test.err {
+				t.Errorf("expected error %q, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestParsePartialCaseID(t *testing.T) {
+	l := loadTestProject(t, selectorTestProject)
+	c, err := l.ParsePartialCaseID("ingress=none")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c) != 1 || c["ingress"] != "none" || c.Maps("db") {
+		t.Errorf("ParsePartialCaseID(ingress=none) = %v", c)
+	}
+	c, err = l.ParsePartialCaseID("ingress=none,db=postgres")
+	if err != nil || l.CaseID(c) != "db=postgres,ingress=none" {
+		t.Errorf("ParsePartialCaseID(ingress=none,db=postgres) = %v, %v", c, err)
+	}
+}
+
+func TestResolveCase(t *testing.T) {
+	l := loadTestProject(t, selectorTestProject+"restrictions: {no-db-or-ingress: {db: none, ingress: none}}\n")
+	allowed := Case{"db": "postgres", "ingress": "none"}
+	discarded := Case{"db": "none", "ingress": "none"}
+	tests := []struct {
+		ref  string
+		want string
+		err  string
+	}{
+		{ref: "db=postgres,ingress=none", want: "db=postgres,ingress=none"},
+		{ref: "ingress=none,db=postgres", want: "db=postgres,ingress=none"},
+		{ref: l.CaseHash(allowed), want: "db=postgres,ingress=none"},
+		{ref: "db=none,ingress=none", err: "Case db=none,ingress=none is not allowed by the project's rules"},
+		{ref: l.CaseHash(discarded), err: "No allowed case has hash " + l.CaseHash(discarded)},
+		{ref: "0123456789", err: "No allowed case has hash 0123456789"},
+		{ref: "db=postgres", err: "parse case ID db=postgres: Variable ingress is not mapped"},
+		{ref: "db=postgres,ingress=none,db=mysql", err: "parse case ID db=postgres,ingress=none,db=mysql: Variable db is mapped more than once"},
+	}
+	for _, test := range tests {
+		t.Run(test.ref, func(t *testing.T) {
+			c, err := l.ResolveCase(test.ref)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("expected error containing %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if l.CaseID(c) != test.want {
+				t.Errorf("ResolveCase(%s) = %s, want %s", test.ref, l.CaseID(c), test.want)
+			}
+		})
+	}
+}
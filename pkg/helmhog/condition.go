@@ -0,0 +1,244 @@
+package helmhog
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	ConditionAllOf = "allOf"
+	ConditionAnyOf = "anyOf"
+	ConditionNot   = "not"
+)
+
+// A ChoiceSet matches any of its choices, or, if negated, none of them.
+// In YAML, it is either a single choice, a list of choices, or an object with a single "not" key
+// containing a single choice or a list of choices.
+type ChoiceSet struct {
+	Choices []ChoiceName
+	Negate  bool
+}
+
+func (s ChoiceSet) Matches(choice ChoiceName) bool {
+	for _, candidate := range s.Choices {
+		if candidate == choice {
+			return !s.Negate
+		}
+	}
+	return s.Negate
+}
+
+func unmarshalChoices(data []byte) ([]ChoiceName, error) {
+	var choice ChoiceName
+	err := json.Unmarshal(data, &choice)
+	if err == nil {
+		return []ChoiceName{choice}, nil
+	}
+	var choices []ChoiceName
+	err = json.Unmarshal(data, &choices)
+	if err != nil {
+		return nil, fmt.Errorf("Expected a choice or list of choices")
+	}
+	if len(choices) == 0 {
+		return nil, fmt.Errorf("List of choices is empty")
+	}
+	return choices, nil
+}
+
+func (s *ChoiceSet) UnmarshalJSON(data []byte) error {
+	var negated map[string]json.RawMessage
+	err := json.Unmarshal(data, &negated)
+	if err != nil {
+		s.Negate = false
+		s.Choices, err = unmarshalChoices(data)
+		return err
+	}
+	notData, ok := negated[ConditionNot]
+	if !ok || len(negated) != 1 {
+		return fmt.Errorf("Expected an object with only a '%s' key", ConditionNot)
+	}
+	s.Negate = true
+	s.Choices, err = unmarshalChoices(notData)
+	return err
+}
+
+func (s ChoiceSet) MarshalJSON() ([]byte, error) {
+	var choices interface{} = s.Choices
+	if len(s.Choices) == 1 {
+		choices = s.Choices[0]
+	}
+	if s.Negate {
+		return json.Marshal(map[string]interface{}{ConditionNot: choices})
+	}
+	return json.Marshal(choices)
+}
+
+// A Condition matches a case if every one of its mappings match, and all of its combinators match.
+// In YAML, it is an object whose keys are either variable names, whose values are ChoiceSets, or one of the combinators
+// "allOf" (a list of conditions which must all match),
+// "anyOf" (a list of conditions at least one of which must match),
+// and "not" (a condition which must not match).
+// An empty condition matches every case.
+type Condition struct {
+	Mappings map[VariableName]ChoiceSet
+	AllOf    []Condition
+	AnyOf    []Condition
+	Not      *Condition
+}
+
+func (c *Condition) IsEmpty() bool {
+	return len(c.Mappings) == 0 && len(c.AllOf) == 0 && len(c.AnyOf) == 0 && c.Not == nil
+}
+
+func (c *Condition) Matches(cs Case) bool {
+	for name, choices := range c.Mappings {
+		if !choices.Matches(cs[name]) {
+			return false
+		}
+	}
+	for ix := range c.AllOf {
+		if !c.AllOf[ix].Matches(cs) {
+			return false
+		}
+	}
+	if len(c.AnyOf) != 0 {
+		matched := false
+		for ix := range c.AnyOf {
+			if c.AnyOf[ix].Matches(cs) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if c.Not != nil && c.Not.Matches(cs) {
+		return false
+	}
+	return true
+}
+
+func (c *Condition) addVariables(names map[VariableName]struct{}) {
+	for name := range c.Mappings {
+		names[name] = struct{}{}
+	}
+	for ix := range c.AllOf {
+		c.AllOf[ix].addVariables(names)
+	}
+	for ix := range c.AnyOf {
+		c.AnyOf[ix].addVariables(names)
+	}
+	if c.Not != nil {
+		c.Not.addVariables(names)
+	}
+}
+
+// Variables returns the names of every variable the condition refers to, in sorted order
+func (c *Condition) Variables() []VariableName {
+	nameSet := make(map[VariableName]struct{})
+	c.addVariables(nameSet)
+	names := make([]VariableName, 0, len(nameSet))
+	for name := range nameSet {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Check ensures that a condition only refers to variables and choices that exist in the project
+func (c *Condition) Check(p *Project) error {
+	for name, choices := range c.Mappings {
+		if _, ok := p.Variables[name]; !ok {
+			return fmt.Errorf("Undefined variable %s", name)
+		}
+		for _, choice := range choices.Choices {
+			if _, ok := p.Variables[name][choice]; !ok {
+				return fmt.Errorf("Variable %s has no choice %s", name, choice)
+			}
+		}
+	}
+	for ix := range c.AllOf {
+		err := c.AllOf[ix].Check(p)
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("%s[%d]", ConditionAllOf, ix))
+		}
+	}
+	for ix := range c.AnyOf {
+		err := c.AnyOf[ix].Check(p)
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("%s[%d]", ConditionAnyOf, ix))
+		}
+	}
+	if c.Not != nil {
+		err := c.Not.Check(p)
+		if err != nil {
+			return errors.Wrap(err, ConditionNot)
+		}
+	}
+	return nil
+}
+
+func (c *Condition) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal(data, &fields)
+	if err != nil {
+		return err
+	}
+	*c = Condition{}
+	for key, value := range fields {
+		switch key {
+		case ConditionAllOf:
+			err = json.Unmarshal(value, &c.AllOf)
+		case ConditionAnyOf:
+			err = json.Unmarshal(value, &c.AnyOf)
+			if err == nil && len(c.AnyOf) == 0 {
+				err = fmt.Errorf("List of conditions is empty")
+			}
+		case ConditionNot:
+			c.Not = new(Condition)
+			err = json.Unmarshal(value, c.Not)
+		default:
+			var choices ChoiceSet
+			err = json.Unmarshal(value, &choices)
+			if err == nil {
+				if c.Mappings == nil {
+					c.Mappings = make(map[VariableName]ChoiceSet)
+				}
+				c.Mappings[key] = choices
+			}
+		}
+		if err != nil {
+			return errors.Wrap(err, key)
+		}
+	}
+	return nil
+}
+
+func (c Condition) MarshalJSON() ([]byte, error) {
+	fields := make(map[string]interface{}, len(c.Mappings)+3)
+	for name, choices := range c.Mappings {
+		fields[name] = choices
+	}
+	if len(c.AllOf) != 0 {
+		fields[ConditionAllOf] = c.AllOf
+	}
+	if len(c.AnyOf) != 0 {
+		fields[ConditionAnyOf] = c.AnyOf
+	}
+	if c.Not != nil {
+		fields[ConditionNot] = c.Not
+	}
+	return json.Marshal(fields)
+}
+
+func (c Condition) String() string {
+	conditionBytes, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Sprintf("<%v>", err)
+	}
+	return string(conditionBytes)
+}
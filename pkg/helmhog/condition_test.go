@@ -0,0 +1,152 @@
+package helmhog
+
+import (
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+const conditionTestProject = `
+apiVersion: helm-hog.meln5674.github.com/v1alpha1
+kind: Project
+parts:
+  p: {}
+variables:
+  storage: {local: [p], s3: [p], gcs: [p]}
+  credentials: {none: [p], static: [p], irsa: [p]}
+  tls: {disabled: [p], enabled: [p]}
+  ingress: {nginx: [p], traefik: [p], none: [p]}
+  traefik-version: {v1: [p], v2: [p], v3: [p]}
+`
+
+func TestCondition(t *testing.T) {
+	l := loadTestProject(t, conditionTestProject)
+	base := Case{"storage": "local", "credentials": "none", "tls": "disabled", "ingress": "nginx", "traefik-version": "v1"}
+	tests := []struct {
+		name      string
+		condition string
+		matches   []Case
+		excludes  []Case
+		variables []VariableName
+	}{
+		{
+			name:      "empty",
+			condition: `{}`,
+			matches:   []Case{base},
+		},
+		{
+			name:      "mappings",
+			condition: `{storage: local, tls: disabled}`,
+			matches:   []Case{base},
+			excludes:  []Case{base.With("storage", "s3"), base.With("tls", "enabled")},
+			variables: []VariableName{"storage", "tls"},
+		},
+		{
+			name:      "choice list",
+			condition: `{storage: [s3, gcs]}`,
+			matches:   []Case{base.With("storage", "s3"), base.With("storage", "gcs")},
+			excludes:  []Case{base},
+			variables: []VariableName{"storage"},
+		},
+		{
+			name:      "negated choice",
+			condition: `{credentials: {not: none}}`,
+			matches:   []Case{base.With("credentials", "static"), base.With("credentials", "irsa")},
+			excludes:  []Case{base},
+			variables: []VariableName{"credentials"},
+		},
+		{
+			name:      "negated choice list",
+			condition: `{ingress: {not: [nginx, traefik]}}`,
+			matches:   []Case{base.With("ingress", "none")},
+			excludes:  []Case{base, base.With("ingress", "traefik")},
+			variables: []VariableName{"ingress"},
+		},
+		{
+			name:      "anyOf",
+			condition: `{anyOf: [{ingress: nginx}, {ingress: traefik, traefik-version: {not: [v1, v2]}}]}`,
+			matches:   []Case{base, base.With("ingress", "traefik").With("traefik-version", "v3")},
+			excludes:  []Case{base.With("ingress", "traefik"), base.With("ingress", "none").With("traefik-version", "v3")},
+			variables: []VariableName{"ingress", "traefik-version"},
+		},
+		{
+			name:      "allOf",
+			condition: `{allOf: [{storage: [s3, gcs]}, {credentials: {not: none}}]}`,
+			matches:   []Case{base.With("storage", "s3").With("credentials", "irsa")},
+			excludes:  []Case{base, base.With("storage", "s3"), base.With("credentials", "irsa")},
+			variables: []VariableName{"credentials", "storage"},
+		},
+		{
+			name:      "not",
+			condition: `{tls: enabled, not: {ingress: none}}`,
+			matches:   []Case{base.With("tls", "enabled")},
+			excludes:  []Case{base, base.With("tls", "enabled").With("ingress", "none")},
+			variables: []VariableName{"ingress", "tls"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var condition Condition
+			err := yaml.Unmarshal([]byte(test.condition), &condition)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = condition.Check(l.Project)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, c := range test.matches {
+				if !condition.Matches(c) {
+					t.Errorf("%s does not match %s", condition, l.CaseID(c))
+				}
+			}
+			for _, c := range test.excludes {
+				if condition.Matches(c) {
+					t.Errorf("%s matches %s", condition, l.CaseID(c))
+				}
+			}
+			if strings.Join(condition.Variables(), ",") != strings.Join(test.variables, ",") {
+				t.Errorf("%s refers to %v, want %v", condition, condition.Variables(), test.variables)
+			}
+
+			var reparsed Condition
+			err = yaml.Unmarshal([]byte(condition.String()), &reparsed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reparsed.String() != condition.String() {
+				t.Errorf("%s did not round trip, got %s", condition, reparsed)
+			}
+		})
+	}
+}
+
+func TestConditionErrors(t *testing.T) {
+	l := loadTestProject(t, conditionTestProject)
+	tests := []struct {
+		condition string
+		err       string
+	}{
+		{condition: `{storage: []}`, err: "List of choices is empty"},
+		{condition: `{storage: {not: s3, also: gcs}}`, err: "Expected an object with only a 'not' key"},
+		{condition: `{anyOf: []}`, err: "List of conditions is empty"},
+		{condition: `{storage: 3}`, err: "Expected a choice or list of choices"},
+		{condition: `{cache: redis}`, err: "Undefined variable cache"},
+		{condition: `{storage: {not: [s3, azure]}}`, err: "Variable storage has no choice azure"},
+		{condition: `{anyOf: [{storage: s3}, {ingress: haproxy}]}`, err: "anyOf[1]: Variable ingress has no choice haproxy"},
+		{condition: `{not: {allOf: [{cache: redis}]}}`, err: "not: allOf[0]: Undefined variable cache"},
+	}
+	for _, test := range tests {
+		t.Run(test.condition, func(t *testing.T) {
+			var condition Condition
+			err := yaml.Unmarshal([]byte(test.condition), &condition)
+			if err == nil {
+				err = condition.Check(l.Project)
+			}
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("expected error containing %q, got %v", test.err, err)
+			}
+		})
+	}
+}
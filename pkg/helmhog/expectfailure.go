@@ -0,0 +1,83 @@
+package helmhog
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// An ExpectedFailure is a rule that cases matching a condition must fail to render, e.g. because the chart uses
+// 'fail' to reject incompatible values, and optionally that the error output must match a regular expression.
+type ExpectedFailure struct {
+	When    Condition `json:"when"`
+	Message string    `json:"message,omitempty"`
+}
+
+// A CompiledExpectedFailure is an ExpectedFailure whose message has been compiled
+type CompiledExpectedFailure struct {
+	*ExpectedFailure
+	Name    RuleName
+	message *regexp.Regexp
+}
+
+// CompileExpectedFailure checks that an expected failure only refers to variables and choices that exist in the project,
+// and compiles its message
+func CompileExpectedFailure(p *Project, name RuleName, e *ExpectedFailure) (*CompiledExpectedFailure, error) {
+	if e.When.IsEmpty() {
+		return nil, fmt.Errorf("'when' is empty, every case would be expected to fail")
+	}
+	err := e.When.Check(p)
+	if err != nil {
+		return nil, errors.Wrap(err, "when")
+	}
+	compiled := CompiledExpectedFailure{ExpectedFailure: e, Name: name}
+	if e.Message != "" {
+		compiled.message, err = regexp.Compile(e.Message)
+		if err != nil {
+			return nil, errors.Wrap(err, "message")
+		}
+	}
+	return &compiled, nil
+}
+
+// ExpectedFailure returns the first expected failure, by name, which matches a case, or nil if the case is expected to pass
+func (l *LoadedProject) ExpectedFailure(c Case) *CompiledExpectedFailure {
+	names := make([]RuleName, 0, len(l.ExpectFailure))
+	for name := range l.ExpectFailure {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return names[i] < names[j] })
+	for _, name := range names {
+		if l.ExpectFailure[name].When.Matches(c) {
+			return l.ExpectFailure[name]
+		}
+	}
+	return nil
+}
+
+// CheckExpectedFailure renders a case which is expected to fail, and returns an error if it did not fail,
+// or if its error output did not match the expected message
+func (l *LoadedProject) CheckExpectedFailure(ctx context.Context, c Case, e *CompiledExpectedFailure) error {
+	renderErr := RunContext(ctx, l.Template(c))
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	if renderErr == nil {
+		return fmt.Errorf("Expected failure %s: rendering succeeded, but was expected to fail", e.Name)
+	}
+	if e.message == nil {
+		return nil
+	}
+	output, err := os.ReadFile(l.TemplateErrPath(c))
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("read file %s", l.TemplateErrPath(c)))
+	}
+	if !e.message.Match(output) {
+		return fmt.Errorf("Expected failure %s: rendering failed, but its output did not match /%s/: %v", e.Name, e.Message, renderErr)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package helmhog
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+func TestExpectedFailure(t *testing.T) {
+	l := loadTestProject(t, selectorTestProject+`
+expectFailure:
+  b-no-db: {when: {db: none}}
+  a-no-db-or-ingress: {when: {db: none, ingress: none}}
+  c-mysql-without-ingress: {when: {db: mysql, ingress: none}, message: 'ingress'}
+`)
+	tests := []struct {
+		c    Case
+		want RuleName
+	}{
+		{c: Case{"db": "none", "ingress": "none"}, want: "a-no-db-or-ingress"},
+		{c: Case{"db": "none", "ingress": "nginx"}, want: "b-no-db"},
+		{c: Case{"db": "mysql", "ingress": "none"}, want: "c-mysql-without-ingress"},
+		{c: Case{"db": "mysql", "ingress": "nginx"}},
+		{c: Case{"db": "postgres", "ingress": "none"}},
+	}
+	for _, test := range tests {
+		e := l.ExpectedFailure(test.c)
+		var name RuleName
+		if e != nil {
+			name = e.Name
+		}
+		if name != test.want {
+			t.Errorf("ExpectedFailure(%s) = %q, want %q", l.CaseID(test.c), name, test.want)
+		}
+	}
+}
+
+func TestCompileExpectedFailureErrors(t *testing.T) {
+	tests := []struct {
+		expected string
+		err      string
+	}{
+		{expected: `{when: {}}`, err: "'when' is empty, every case would be expected to fail"},
+		{expected: `{when: {db: sqlite}}`, err: "when: Variable db has no choice sqlite"},
+		{expected: `{when: {db: none}, message: '('}`, err: "message: error parsing regexp"},
+	}
+	for _, test := range tests {
+		t.Run(test.expected, func(t *testing.T) {
+			p := new(Project)
+			err := yaml.Unmarshal([]byte(selectorTestProject+"expectFailure: {test: "+test.expected+"}\n"), p)
+			if err == nil {
+				_, err = p.Load(ProjectSettings{})
+			}
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("expected error containing %q, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestCheckExpectedFailure(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+		c        Case
+		err      string
+	}{
+		{
+			name:     "failed",
+			expected: `{when: {greeting: broken}}`,
+			c:        Case{"greeting": "broken", "scale": "single", "config": "default"},
+		},
+		{
+			name:     "failed with matching message",
+			expected: `{when: {greeting: broken}, message: 'at <lower>: wrong type for value'}`,
+			c:        Case{"greeting": "broken", "scale": "single", "config": "default"},
+		},
+		{
+			name:     "failed with other message",
+			expected: `{when: {greeting: broken}, message: 'greeting is required'}`,
+			c:        Case{"greeting": "broken", "scale": "single", "config": "default"},
+			err:      "Expected failure test: rendering failed, but its output did not match /greeting is required/",
+		},
+		{
+			name:     "passed",
+			expected: `{when: {scale: replicated}, message: 'replicas'}`,
+			c:        Case{"greeting": "default", "scale": "replicated", "config": "default"},
+			err:      "Expected failure test: rendering succeeded, but was expected to fail",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l := loadTestProjectWithSettings(t, chartTestProject+"expectFailure: {test: "+test.expected+"}\n", ProjectSettings{Engine: EngineSDK})
+			e := l.ExpectedFailure(test.c)
+			if e == nil {
+				t.Fatalf("Case %s is not expected to fail", l.CaseID(test.c))
+			}
+			err := l.MakeCaseTempDir(test.c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = l.CheckExpectedFailure(context.Background(), test.c, e)
+			if test.err == "" && err != nil {
+				t.Errorf("CheckExpectedFailure() = %v", err)
+			}
+			if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Errorf("expected error containing %q, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestCheckExpectedFailureCancelled(t *testing.T) {
+	l := loadTestProjectWithSettings(t, chartTestProject+"expectFailure: {test: {when: {greeting: broken}}}\n", ProjectSettings{Engine: EngineSDK})
+	c := Case{"greeting": "broken", "scale": "single", "config": "default"}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := l.CheckExpectedFailure(ctx, c, l.ExpectedFailure(c))
+	if err != context.Canceled {
+		t.Errorf("CheckExpectedFailure() = %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,227 @@
+package helmhog
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A RuleDiscards is a rule and how many cases it discards
+type RuleDiscards struct {
+	Rule  NamedRule
+	Cases int
+}
+
+// An ExplanationStep is a rule which applies to a mapping, or to the mappings implied by the previous steps
+type ExplanationStep struct {
+	Rule NamedRule
+	// Implies are the mappings the rule requires, if it is a requirement
+	Implies Case
+	// Conflict describes why the rule cannot be satisfied by the mapping and the mappings implied by the previous steps,
+	// or is empty if it can be
+	Conflict string
+}
+
+// An Explanation describes how a project's rules treat the cases containing a (partial) mapping
+type Explanation struct {
+	Mapping Case
+	// Limited is true if there were more cases containing the mapping than the limit, so they were not checked,
+	// and only Chain is set
+	Limited bool
+	// Total is the number of cases in the cartesian product of all variables which contain the mapping
+	Total int
+	// Allowed is the number of those cases which are allowed
+	Allowed int
+	// Example is the first allowed case containing the mapping, if any
+	Example Case
+	// Discards is every rule which discards any case containing the mapping, from most cases discarded to least
+	Discards []RuleDiscards
+	// Blocking is a small set of rules which, together, discard every case containing the mapping,
+	// if none are allowed
+	Blocking []NamedRule
+	// Chain is the requirements which are triggered by the mapping, including those triggered by mappings
+	// required by other requirements, along with any other rules those mappings conflict with
+	Chain []ExplanationStep
+}
+
+// Explain finds out whether any allowed case contains a mapping, and if not, which rules are responsible.
+// If more than limit cases contain the mapping, they are not walked, and only the chain of rules is explained. A limit of 0 means no limit.
+func (l *LoadedProject) Explain(mapping Case, limit int) *Explanation {
+	e := Explanation{Mapping: mapping}
+	rules := l.Rules()
+
+	if limit != 0 {
+		size := 1
+		for name, choices := range l.Variables {
+			if _, ok := mapping[name]; ok {
+				continue
+			}
+			size *= len(choices)
+			if size > limit {
+				e.Limited = true
+				e.Chain = l.explainChain(rules, mapping)
+				return &e
+			}
+		}
+	}
+
+	cases := make(chan Case)
+	go l.generateProduct(cases, func(c Case) bool {
+		for name, choice := range mapping {
+			if mapped, ok := c[name]; ok && mapped != choice {
+				return false
+			}
+		}
+		return true
+	})
+
+	discards := make([]int, len(rules))
+	// For each case which is not allowed, the set of rule indexes which discard it
+	discardedBy := make([]map[int]struct{}, 0)
+	for c := range cases {
+		e.Total++
+		discarded := make(map[int]struct{})
+		for ix, rule := range rules {
+			if !rule.Allows(c) {
+				discards[ix]++
+				discarded[ix] = struct{}{}
+			}
+		}
+		if len(discarded) != 0 {
+			discardedBy = append(discardedBy, discarded)
+			continue
+		}
+		e.Allowed++
+		if e.Example == nil {
+			e.Example = c
+		}
+	}
+
+	for ix, rule := range rules {
+		if discards[ix] != 0 {
+			e.Discards = append(e.Discards, RuleDiscards{Rule: rule, Cases: discards[ix]})
+		}
+	}
+	sort.SliceStable(e.Discards, func(i, j int) bool { return e.Discards[i].Cases > e.Discards[j].Cases })
+
+	if e.Allowed == 0 {
+		// Greedily pick the rule which discards the most remaining cases until every case is discarded
+		for len(discardedBy) != 0 {
+			best := -1
+			bestCount := 0
+			for ix := range rules {
+				count := 0
+				for _, discarded := range discardedBy {
+					if _, ok := discarded[ix]; ok {
+						count++
+					}
+				}
+				if count > bestCount {
+					best = ix
+					bestCount = count
+				}
+			}
+			e.Blocking = append(e.Blocking, rules[best])
+			remaining := discardedBy[:0]
+			for _, discarded := range discardedBy {
+				if _, ok := discarded[best]; !ok {
+					remaining = append(remaining, discarded)
+				}
+			}
+			discardedBy = remaining
+		}
+	}
+
+	e.Chain = l.explainChain(rules, mapping)
+
+	return &e
+}
+
+// simpleMappings returns the mappings a condition requires, if it consists only of single-choice mappings
+func simpleMappings(c *Condition) (Case, bool) {
+	if len(c.AllOf) != 0 || len(c.AnyOf) != 0 || c.Not != nil {
+		return nil, false
+	}
+	mappings := make(Case, len(c.Mappings))
+	for name, choices := range c.Mappings {
+		if choices.Negate || len(choices.Choices) != 1 {
+			return nil, false
+		}
+		mappings[name] = choices.Choices[0]
+	}
+	return mappings, true
+}
+
+func (l *LoadedProject) explainChain(rules []NamedRule, mapping Case) []ExplanationStep {
+	chain := make([]ExplanationStep, 0)
+	implied := make(Case, len(mapping))
+	for name, choice := range mapping {
+		implied[name] = choice
+	}
+	applied := make(map[int]struct{})
+
+	for changed := true; changed; {
+		changed = false
+		for ix, rule := range rules {
+			if _, ok := applied[ix]; ok {
+				continue
+			}
+			req, ok := rule.Rule.(*Requirement)
+			if !ok {
+				continue
+			}
+			if !implied.Maps(req.If.Variables()...) || !req.If.Matches(implied) {
+				continue
+			}
+			applied[ix] = struct{}{}
+			step := ExplanationStep{Rule: rule}
+			if implied.Maps(req.Then.Variables()...) {
+				if !req.Then.Matches(implied) {
+					step.Conflict = fmt.Sprintf("%s does not match %s", l.CaseID(implied), req.Then)
+				}
+				chain = append(chain, step)
+				if step.Conflict != "" {
+					return chain
+				}
+				continue
+			}
+			then, ok := simpleMappings(&req.Then)
+			if !ok {
+				// The requirement could be satisfied in more than one way, so it cannot be followed any further
+				chain = append(chain, step)
+				continue
+			}
+			step.Implies = then
+			conflicts := make([]string, 0)
+			for name, choice := range then {
+				if existing, ok := implied[name]; ok && existing != choice {
+					conflicts = append(conflicts, fmt.Sprintf("%s%s%s conflicts with %s%s%s", name, caseIDMappingOperator, choice, name, caseIDMappingOperator, existing))
+				}
+			}
+			chain = append(chain, step)
+			if len(conflicts) != 0 {
+				sort.Strings(conflicts)
+				chain[len(chain)-1].Conflict = strings.Join(conflicts, ", ")
+				return chain
+			}
+			for name, choice := range then {
+				implied[name] = choice
+			}
+			changed = true
+		}
+	}
+
+	// Once no more requirements apply, check if any other rule discards the implied mappings outright
+	for _, rule := range rules {
+		if _, ok := rule.Rule.(*Requirement); ok {
+			continue
+		}
+		if implied.Maps(rule.Variables()...) && !rule.Allows(implied) {
+			chain = append(chain, ExplanationStep{
+				Rule:     rule,
+				Conflict: fmt.Sprintf("discards %s", l.CaseID(implied)),
+			})
+		}
+	}
+	return chain
+}
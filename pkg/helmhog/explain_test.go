@@ -0,0 +1,208 @@
+package helmhog
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   string
+		mapping Case
+		limit   int
+		limited bool
+		total   int
+		allowed int
+		// discards are the rules which discard cases and how many, from most to least
+		discards []string
+		blocking []string
+		// chain are the steps of the chain, as "rule requires mappings: conflict"
+		chain []string
+	}{
+		{
+			name:    "no rules",
+			mapping: Case{"db": "postgres"},
+			total:   4,
+			allowed: 4,
+		},
+		{
+			name: "some cases allowed",
+			rules: `
+restrictions:
+  no-mysql-with-tls: {db: mysql, tls: enabled}
+`,
+			mapping:  Case{"db": "mysql"},
+			total:    4,
+			allowed:  2,
+			discards: []string{"Restriction no-mysql-with-tls: 2"},
+		},
+		{
+			name: "one rule blocks every case",
+			rules: `
+restrictions:
+  no-mysql: {db: mysql}
+  no-mysql-with-tls: {db: mysql, tls: enabled}
+`,
+			mapping:  Case{"db": "mysql"},
+			total:    4,
+			discards: []string{"Restriction no-mysql: 4", "Restriction no-mysql-with-tls: 2"},
+			blocking: []string{"Restriction no-mysql"},
+			chain:    []string{"Restriction no-mysql requires : discards db=mysql"},
+		},
+		{
+			name: "blocking rules are picked by how many remaining cases they discard",
+			rules: `
+restrictions:
+  mysql-many-no-tls: {db: mysql, replicas: many, tls: disabled}
+  mysql-many-tls: {db: mysql, replicas: many, tls: enabled}
+  mysql-one: {db: mysql, replicas: one}
+  mysql-tls: {db: mysql, tls: enabled}
+`,
+			mapping: Case{"db": "mysql"},
+			total:   4,
+			discards: []string{
+				"Restriction mysql-one: 2",
+				"Restriction mysql-tls: 2",
+				"Restriction mysql-many-no-tls: 1",
+				"Restriction mysql-many-tls: 1",
+			},
+			blocking: []string{"Restriction mysql-one", "Restriction mysql-many-no-tls", "Restriction mysql-many-tls"},
+		},
+		{
+			name: "chain of requirements which conflicts with the mapping",
+			rules: `
+requirements:
+  many-replicas-need-tls: {if: {replicas: many}, then: {tls: enabled}}
+  tls-needs-postgres: {if: {tls: enabled}, then: {db: postgres}}
+`,
+			mapping:  Case{"db": "mysql", "replicas": "many"},
+			total:    2,
+			discards: []string{"Requirement many-replicas-need-tls: 1", "Requirement tls-needs-postgres: 1"},
+			blocking: []string{"Requirement many-replicas-need-tls", "Requirement tls-needs-postgres"},
+			chain: []string{
+				"Requirement many-replicas-need-tls requires tls=enabled: ",
+				`Requirement tls-needs-postgres requires : db=mysql,replicas=many,tls=enabled does not match {"db":"postgres"}`,
+			},
+		},
+		{
+			name: "requirement which implies a mapping conflicting with the mapping",
+			rules: `
+requirements:
+  many-replicas-need-postgres-and-tls: {if: {replicas: many}, then: {db: postgres, tls: enabled}}
+`,
+			mapping:  Case{"db": "mysql", "replicas": "many"},
+			total:    2,
+			discards: []string{"Requirement many-replicas-need-postgres-and-tls: 2"},
+			blocking: []string{"Requirement many-replicas-need-postgres-and-tls"},
+			chain:    []string{"Requirement many-replicas-need-postgres-and-tls requires db=postgres,tls=enabled: db=postgres conflicts with db=mysql"},
+		},
+		{
+			name: "requirement whose then is already mapped",
+			rules: `
+requirements:
+  many-replicas-need-tls: {if: {replicas: many}, then: {tls: enabled}}
+`,
+			mapping:  Case{"replicas": "many", "tls": "disabled"},
+			total:    3,
+			discards: []string{"Requirement many-replicas-need-tls: 3"},
+			blocking: []string{"Requirement many-replicas-need-tls"},
+			chain:    []string{`Requirement many-replicas-need-tls requires : replicas=many,tls=disabled does not match {"tls":"enabled"}`},
+		},
+		{
+			name: "requirement which can be satisfied more than one way",
+			rules: `
+requirements:
+  many-replicas-need-db: {if: {replicas: many}, then: {db: [postgres, mysql]}}
+  tls-needs-many-replicas: {if: {tls: enabled}, then: {replicas: many}}
+`,
+			mapping:  Case{"tls": "enabled"},
+			total:    6,
+			allowed:  2,
+			discards: []string{"Requirement tls-needs-many-replicas: 3", "Requirement many-replicas-need-db: 1"},
+			chain: []string{
+				"Requirement tls-needs-many-replicas requires replicas=many: ",
+				"Requirement many-replicas-need-db requires : ",
+			},
+		},
+		{
+			name: "restriction which discards the implied mappings",
+			rules: `
+requirements:
+  many-replicas-need-tls: {if: {replicas: many}, then: {tls: enabled}}
+restrictions:
+  no-mysql-with-tls: {db: mysql, tls: enabled}
+`,
+			mapping:  Case{"db": "mysql", "replicas": "many"},
+			total:    2,
+			discards: []string{"Requirement many-replicas-need-tls: 1", "Restriction no-mysql-with-tls: 1"},
+			blocking: []string{"Requirement many-replicas-need-tls", "Restriction no-mysql-with-tls"},
+			chain: []string{
+				"Requirement many-replicas-need-tls requires tls=enabled: ",
+				"Restriction no-mysql-with-tls requires : discards db=mysql,replicas=many,tls=enabled",
+			},
+		},
+		{
+			name: "too many cases",
+			rules: `
+requirements:
+  many-replicas-need-tls: {if: {replicas: many}, then: {tls: enabled}}
+restrictions:
+  no-mysql: {db: mysql}
+`,
+			mapping: Case{"replicas": "many"},
+			limit:   5,
+			limited: true,
+			chain:   []string{"Requirement many-replicas-need-tls requires tls=enabled: "},
+		},
+		{
+			name: "exactly the limit",
+			rules: `
+restrictions:
+  no-mysql: {db: mysql}
+`,
+			mapping:  Case{"replicas": "many"},
+			limit:    6,
+			total:    6,
+			allowed:  4,
+			discards: []string{"Restriction no-mysql: 2"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l := loadTestProject(t, analysisTestProject+test.rules)
+			e := l.Explain(test.mapping, test.limit)
+			if e.Limited != test.limited || e.Total != test.total || e.Allowed != test.allowed {
+				t.Errorf("Explain() is limited=%v, %d of %d allowed, want limited=%v, %d of %d allowed", e.Limited, e.Allowed, e.Total, test.limited, test.allowed, test.total)
+			}
+			if (e.Example != nil) != (test.allowed != 0) {
+				t.Errorf("Example is %v with %d allowed cases", e.Example, test.allowed)
+			} else if e.Example != nil && !l.Allows(e.Example) {
+				t.Errorf("Example %s is not allowed", l.CaseID(e.Example))
+			}
+
+			discards := make([]string, 0, len(e.Discards))
+			for _, d := range e.Discards {
+				discards = append(discards, fmt.Sprintf("%s: %d", d.Rule, d.Cases))
+			}
+			if strings.Join(discards, "\n") != strings.Join(test.discards, "\n") {
+				t.Errorf("Got discards:\n%s\nwant:\n%s", strings.Join(discards, "\n"), strings.Join(test.discards, "\n"))
+			}
+			blocking := make([]string, 0, len(e.Blocking))
+			for _, rule := range e.Blocking {
+				blocking = append(blocking, rule.String())
+			}
+			if strings.Join(blocking, "\n") != strings.Join(test.blocking, "\n") {
+				t.Errorf("Got blocking rules:\n%s\nwant:\n%s", strings.Join(blocking, "\n"), strings.Join(test.blocking, "\n"))
+			}
+			chain := make([]string, 0, len(e.Chain))
+			for _, step := range e.Chain {
+				chain = append(chain, fmt.Sprintf("%s requires %s: %s", step.Rule, l.CaseID(step.Implies), step.Conflict))
+			}
+			if strings.Join(chain, "\n") != strings.Join(test.chain, "\n") {
+				t.Errorf("Got chain:\n%s\nwant:\n%s", strings.Join(chain, "\n"), strings.Join(test.chain, "\n"))
+			}
+		})
+	}
+}
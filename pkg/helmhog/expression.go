@@ -0,0 +1,196 @@
+package helmhog
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/operators"
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+)
+
+const (
+	// ExpressionCaseVariable is the name of the variable which holds the case being evaluated,
+	// as a map from variable names to choice names
+	ExpressionCaseVariable = "case"
+)
+
+// An Expression is a compiled CEL expression which evaluates to true for cases which are allowed,
+// e.g. case.replicas != "one" || case.persistence == "none"
+type Expression struct {
+	Source    string
+	program   cel.Program
+	variables []VariableName
+}
+
+// CompileExpression compiles a CEL expression, and checks that it evaluates to a boolean,
+// and that it only refers to variables and choices that exist in the project
+func CompileExpression(p *Project, source string) (*Expression, error) {
+	env, err := cel.NewEnv(cel.Variable(ExpressionCaseVariable, cel.MapType(cel.StringType, cel.StringType)))
+	if err != nil {
+		return nil, errors.Wrap(err, "create CEL environment")
+	}
+	ast, iss := env.Compile(source)
+	if iss.Err() != nil {
+		return nil, iss.Err()
+	}
+	if ast.OutputType() != cel.BoolType {
+		return nil, fmt.Errorf("Expression must evaluate to a bool, not %v", ast.OutputType())
+	}
+	checked, err := cel.AstToCheckedExpr(ast)
+	if err != nil {
+		return nil, err
+	}
+	variables := make(map[VariableName]struct{})
+	err = checkExpression(p, checked.Expr, variables)
+	if err != nil {
+		return nil, err
+	}
+	program, err := env.Program(ast)
+	if err != nil {
+		return nil, err
+	}
+
+	e := Expression{Source: source, program: program}
+	for name := range variables {
+		e.variables = append(e.variables, name)
+	}
+	sort.Strings(e.variables)
+	return &e, nil
+}
+
+// expressionCaseRef returns the name of the variable if e is a reference to a variable of the case,
+// i.e. case.name or case["name"]
+func expressionCaseRef(e *exprpb.Expr) (VariableName, bool) {
+	isCase := func(e *exprpb.Expr) bool {
+		ident := e.GetIdentExpr()
+		return ident != nil && ident.Name == ExpressionCaseVariable
+	}
+	if sel := e.GetSelectExpr(); sel != nil && isCase(sel.Operand) {
+		return sel.Field, true
+	}
+	if call := e.GetCallExpr(); call != nil && call.Function == operators.Index && len(call.Args) == 2 && isCase(call.Args[0]) {
+		if name, ok := expressionStrings(call.Args[1]); ok && len(name) == 1 {
+			return name[0], true
+		}
+	}
+	return "", false
+}
+
+// expressionStrings returns the values of e if it is a string literal or a list of string literals
+func expressionStrings(e *exprpb.Expr) ([]string, bool) {
+	if c := e.GetConstExpr(); c != nil {
+		if s, ok := c.ConstantKind.(*exprpb.Constant_StringValue); ok {
+			return []string{s.StringValue}, true
+		}
+		return nil, false
+	}
+	if list := e.GetListExpr(); list != nil {
+		strs := make([]string, 0, len(list.Elements))
+		for _, elem := range list.Elements {
+			s, ok := expressionStrings(elem)
+			if !ok || len(s) != 1 {
+				return nil, false
+			}
+			strs = append(strs, s[0])
+		}
+		return strs, true
+	}
+	return nil, false
+}
+
+// checkExpression recursively checks that every reference to a variable of the case refers to a variable
+// in the project, and that every comparison of such a variable to literals refers to choices of that variable.
+// The names of referenced variables are added to variables.
+func checkExpression(p *Project, e *exprpb.Expr, variables map[VariableName]struct{}) error {
+	if e == nil {
+		return nil
+	}
+	if name, ok := expressionCaseRef(e); ok {
+		if _, ok := p.Variables[name]; !ok {
+			return fmt.Errorf("Undefined variable %s", name)
+		}
+		variables[name] = struct{}{}
+		return nil
+	}
+	children := []*exprpb.Expr{}
+	switch kind := e.ExprKind.(type) {
+	case *exprpb.Expr_IdentExpr:
+		// The case is used in some way other than referring to a single variable, so assume it refers to all of them
+		if kind.IdentExpr.Name == ExpressionCaseVariable {
+			for name := range p.Variables {
+				variables[name] = struct{}{}
+			}
+		}
+	case *exprpb.Expr_SelectExpr:
+		children = append(children, kind.SelectExpr.Operand)
+	case *exprpb.Expr_CallExpr:
+		call := kind.CallExpr
+		var compared [][2]*exprpb.Expr
+		switch call.Function {
+		case operators.Equals, operators.NotEquals:
+			if len(call.Args) == 2 {
+				compared = [][2]*exprpb.Expr{{call.Args[0], call.Args[1]}, {call.Args[1], call.Args[0]}}
+			}
+		case operators.In:
+			if len(call.Args) == 2 {
+				compared = [][2]*exprpb.Expr{{call.Args[0], call.Args[1]}}
+			}
+		}
+		for _, pair := range compared {
+			name, ok := expressionCaseRef(pair[0])
+			if !ok {
+				continue
+			}
+			if _, ok := p.Variables[name]; !ok {
+				return fmt.Errorf("Undefined variable %s", name)
+			}
+			choices, ok := expressionStrings(pair[1])
+			if !ok {
+				continue
+			}
+			for _, choice := range choices {
+				if _, ok := p.Variables[name][choice]; !ok {
+					return fmt.Errorf("Variable %s has no choice %s", name, choice)
+				}
+			}
+		}
+		children = append(children, call.Target)
+		children = append(children, call.Args...)
+	case *exprpb.Expr_ListExpr:
+		children = append(children, kind.ListExpr.Elements...)
+	case *exprpb.Expr_StructExpr:
+		for _, entry := range kind.StructExpr.Entries {
+			children = append(children, entry.GetMapKey(), entry.Value)
+		}
+	case *exprpb.Expr_ComprehensionExpr:
+		comp := kind.ComprehensionExpr
+		children = append(children, comp.IterRange, comp.AccuInit, comp.LoopCondition, comp.LoopStep, comp.Result)
+	}
+	for _, child := range children {
+		err := checkExpression(p, child, variables)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Variables returns the names of every variable the expression refers to, in sorted order
+func (e *Expression) Variables() []VariableName {
+	return e.variables
+}
+
+// Allows evaluates the expression against a case. Cases for which evaluation fails are not allowed.
+func (e *Expression) Allows(c Case) bool {
+	out, _, err := e.program.Eval(map[string]interface{}{ExpressionCaseVariable: map[string]string(c)})
+	if err != nil {
+		klog.Errorf("Evaluating %s against %v failed: %v", e.Source, c, err)
+		return false
+	}
+	allowed, ok := out.Value().(bool)
+	return ok && allowed
+}
@@ -0,0 +1,109 @@
+package helmhog
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpression(t *testing.T) {
+	l := loadTestProject(t, conditionTestProject)
+	base := Case{"storage": "local", "credentials": "none", "tls": "disabled", "ingress": "nginx", "traefik-version": "v1"}
+	tests := []struct {
+		source    string
+		allows    []Case
+		rejects   []Case
+		variables []VariableName
+	}{
+		{
+			source:    `case.storage == "local" || case.credentials != "none"`,
+			allows:    []Case{base, base.With("storage", "s3").With("credentials", "irsa")},
+			rejects:   []Case{base.With("storage", "s3")},
+			variables: []VariableName{"credentials", "storage"},
+		},
+		{
+			source:    `case["ingress"] in ["nginx", "traefik"] || case.tls == "disabled"`,
+			allows:    []Case{base, base.With("tls", "enabled"), base.With("ingress", "none")},
+			rejects:   []Case{base.With("tls", "enabled").With("ingress", "none")},
+			variables: []VariableName{"ingress", "tls"},
+		},
+		{
+			source:    `case.ingress != "traefik" || !case["traefik-version"].startsWith("v1")`,
+			allows:    []Case{base, base.With("ingress", "traefik").With("traefik-version", "v2")},
+			rejects:   []Case{base.With("ingress", "traefik")},
+			variables: []VariableName{"ingress", "traefik-version"},
+		},
+		{
+			// The case is not only used to look up variables, so the expression is assumed to refer to all of them
+			source:    `case.all(name, case[name] != "none")`,
+			allows:    []Case{base.With("credentials", "static")},
+			rejects:   []Case{base},
+			variables: []VariableName{"credentials", "ingress", "storage", "tls", "traefik-version"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.source, func(t *testing.T) {
+			e, err := CompileExpression(l.Project, test.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, c := range test.allows {
+				if !e.Allows(c) {
+					t.Errorf("%s does not allow %s", test.source, l.CaseID(c))
+				}
+			}
+			for _, c := range test.rejects {
+				if e.Allows(c) {
+					t.Errorf("%s allows %s", test.source, l.CaseID(c))
+				}
+			}
+			if strings.Join(e.Variables(), ",") != strings.Join(test.variables, ",") {
+				t.Errorf("%s refers to %v, want %v", test.source, e.Variables(), test.variables)
+			}
+		})
+	}
+}
+
+func TestExpressionErrors(t *testing.T) {
+	l := loadTestProject(t, conditionTestProject)
+	tests := []struct {
+		source string
+		err    string
+	}{
+		{source: `case.storage`, err: "Expression must evaluate to a bool"},
+		{source: `case.storage ==`, err: "Syntax error"},
+		{source: `case.cache == "redis"`, err: "Undefined variable cache"},
+		{source: `case["cache"] != "redis"`, err: "Undefined variable cache"},
+		{source: `"azure" == case.storage`, err: "Variable storage has no choice azure"},
+		{source: `case.ingress in ["nginx", "haproxy"]`, err: "Variable ingress has no choice haproxy"},
+		{source: `case.tls == "enabled" && has(case.cache)`, err: "Undefined variable cache"},
+	}
+	for _, test := range tests {
+		t.Run(test.source, func(t *testing.T) {
+			_, err := CompileExpression(l.Project, test.source)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("expected error containing %q, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestAllowsPartialWithExpressions(t *testing.T) {
+	l := loadTestProject(t, conditionTestProject+`
+conditions:
+  cloud-storage-needs-credentials: 'case.storage == "local" || case.credentials != "none"'
+`)
+	tests := []struct {
+		c       Case
+		allowed bool
+	}{
+		// Expressions are only checked once every variable they refer to is mapped
+		{c: Case{"storage": "s3"}, allowed: true},
+		{c: Case{"storage": "s3", "credentials": "none"}, allowed: false},
+		{c: Case{"storage": "s3", "credentials": "static"}, allowed: true},
+	}
+	for _, test := range tests {
+		if l.AllowsPartial(test.c) != test.allowed {
+			t.Errorf("AllowsPartial(%s) = %v, want %v", l.CaseID(test.c), !test.allowed, test.allowed)
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package helmhog
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"k8s.io/klog/v2"
+)
+
+type GenerationStrategy string
+
+const (
+	// GenerationStrategyExhaustive generates every allowed case in the cartesian product of all variables
+	GenerationStrategyExhaustive GenerationStrategy = "exhaustive"
+	// GenerationStrategyPairwise generates a set of allowed cases which contains every allowed combination of choices
+	// for every set of Strength variables (an n-wise covering array)
+	GenerationStrategyPairwise GenerationStrategy = "pairwise"
+
+	DefaultGenerationStrategy = GenerationStrategyExhaustive
+	DefaultGenerationStrength = 2
+)
+
+type Generation struct {
+	Strategy GenerationStrategy `json:"strategy,omitempty"`
+	Strength int                `json:"strength,omitempty"`
+}
+
+// Resolve fills in the defaults for any unset fields and checks that the result is valid
+func (g Generation) Resolve() (Generation, error) {
+	if g.Strategy == "" {
+		g.Strategy = DefaultGenerationStrategy
+	}
+	if g.Strength == 0 {
+		g.Strength = DefaultGenerationStrength
+	}
+	switch g.Strategy {
+	case GenerationStrategyExhaustive, GenerationStrategyPairwise:
+	default:
+		return g, fmt.Errorf("Unknown generation strategy %s", g.Strategy)
+	}
+	if g.Strength < 1 {
+		return g, fmt.Errorf("Generation strength must be at least 1, got %d", g.Strength)
+	}
+	return g, nil
+}
+
+func (l *LoadedProject) generateExhaustive(cases chan<- Case) {
+	l.generateProduct(cases, l.AllowsPartial)
+}
+
+// generateProduct walks the cartesian product with the first variable in VariableOrder changing the slowest,
+// and each variable's choices in ChoiceOrder, so that cases are always generated in the same order.
+// Any partial case for which allows returns false is discarded along with every case containing it.
+func (l *LoadedProject) generateProduct(cases chan<- Case, allows func(Case) bool) {
+	outgoing := cases
+	for _, name := range l.ReverseVariableOrder {
+		choices := l.ChoiceOrder[name]
+		incoming := make(chan Case)
+		go func(name string, choices []ChoiceName, incoming <-chan Case, outgoing chan<- Case) {
+			for c := range incoming {
+				for _, choice := range choices {
+					newC := c.With(name, choice)
+					if !allows(newC) {
+						continue
+					}
+					outgoing <- newC
+				}
+			}
+			close(outgoing)
+		}(name, choices, incoming, outgoing)
+		outgoing = incoming
+	}
+
+	outgoing <- Case{}
+	close(outgoing)
+}
+
+// pairwiseGenerator greedily builds an n-wise covering array of the allowed cases.
+// Variables and choices are referred to by their index in VariableOrder and ChoiceOrder, respectively,
+// and an assignment uses -1 to mark a variable which has not yet been mapped.
+type pairwiseGenerator struct {
+	l         *LoadedProject
+	strength  int
+	uncovered map[string]struct{}
+}
+
+func (g *pairwiseGenerator) tupleKey(vars []int, assign []int) string {
+	var key strings.Builder
+	for _, v := range vars {
+		fmt.Fprintf(&key, "%d=%d,", v, assign[v])
+	}
+	return key.String()
+}
+
+func (g *pairwiseGenerator) toCase(assign []int) Case {
+	c := make(Case, len(assign))
+	for v, choice := range assign {
+		if choice == -1 {
+			continue
+		}
+		name := g.l.VariableOrder[v]
+		c[name] = g.l.ChoiceOrder[name][choice]
+	}
+	return c
+}
+
+// combinations calls f with every sorted subset of size n of vars, stopping early if f returns false
+func combinations(vars []int, n int, f func([]int) bool) {
+	combo := make([]int, 0, n)
+	var recurse func(start int) bool
+	recurse = func(start int) bool {
+		if len(combo) == n {
+			return f(combo)
+		}
+		for ix := start; ix <= len(vars)-(n-len(combo)); ix++ {
+			combo = append(combo, vars[ix])
+			if !recurse(ix + 1) {
+				return false
+			}
+			combo = combo[:len(combo)-1]
+		}
+		return true
+	}
+	recurse(0)
+}
+
+func (g *pairwiseGenerator) assigned(assign []int) []int {
+	vars := make([]int, 0, len(assign))
+	for v, choice := range assign {
+		if choice != -1 {
+			vars = append(vars, v)
+		}
+	}
+	return vars
+}
+
+// gain counts how many uncovered tuples would be covered by mapping v to the choice it currently has in assign,
+// only considering tuples whose other variables are already assigned
+func (g *pairwiseGenerator) gain(assign []int, v int) int {
+	others := make([]int, 0, len(assign))
+	for _, other := range g.assigned(assign) {
+		if other != v {
+			others = append(others, other)
+		}
+	}
+	if len(others) < g.strength-1 {
+		return 0
+	}
+	count := 0
+	combinations(others, g.strength-1, func(combo []int) bool {
+		vars := append(make([]int, 0, g.strength), combo...)
+		vars = append(vars, v)
+		sort.Ints(vars)
+		if _, ok := g.uncovered[g.tupleKey(vars, assign)]; ok {
+			count++
+		}
+		return true
+	})
+	return count
+}
+
+// complete attempts to fill in the unassigned variables in order, starting at pos, such that the resulting case is
+// allowed, preferring choices which cover the most uncovered tuples. It returns false if no such completion exists.
+func (g *pairwiseGenerator) complete(assign []int, order []int, pos int) bool {
+	if pos == len(order) {
+		return g.l.Allows(g.toCase(assign))
+	}
+	v := order[pos]
+	name := g.l.VariableOrder[v]
+	candidates := make([]int, len(g.l.ChoiceOrder[name]))
+	gains := make([]int, len(candidates))
+	for choice := range candidates {
+		candidates[choice] = choice
+		assign[v] = choice
+		gains[choice] = g.gain(assign, v)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return gains[candidates[i]] > gains[candidates[j]] })
+	for _, choice := range candidates {
+		assign[v] = choice
+		if g.l.AllowsPartial(g.toCase(assign)) && g.complete(assign, order, pos+1) {
+			return true
+		}
+	}
+	assign[v] = -1
+	return false
+}
+
+func (l *LoadedProject) generatePairwise(cases chan<- Case) {
+	defer close(cases)
+
+	allVars := make([]int, len(l.VariableOrder))
+	for v := range allVars {
+		allVars[v] = v
+	}
+
+	g := pairwiseGenerator{
+		l:         l,
+		strength:  l.Generation.Strength,
+		uncovered: make(map[string]struct{}),
+	}
+	if g.strength > len(allVars) {
+		g.strength = len(allVars)
+	}
+
+	// Enumerate every tuple of choices for every set of variables, in a stable order
+	tuples := make([][]int, 0)
+	combinations(allVars, g.strength, func(combo []int) bool {
+		vars := append([]int{}, combo...)
+		assign := make([]int, len(allVars))
+		for v := range assign {
+			assign[v] = -1
+		}
+		var recurse func(ix int)
+		recurse = func(ix int) {
+			if ix == len(vars) {
+				tuple := append([]int{}, assign...)
+				tuples = append(tuples, tuple)
+				g.uncovered[g.tupleKey(vars, tuple)] = struct{}{}
+				return
+			}
+			for choice := range l.ChoiceOrder[l.VariableOrder[vars[ix]]] {
+				assign[vars[ix]] = choice
+				recurse(ix + 1)
+			}
+			assign[vars[ix]] = -1
+		}
+		recurse(0)
+		return true
+	})
+
+	for _, tuple := range tuples {
+		vars := g.assigned(tuple)
+		key := g.tupleKey(vars, tuple)
+		if _, ok := g.uncovered[key]; !ok {
+			continue
+		}
+		assign := append([]int{}, tuple...)
+		order := make([]int, 0, len(allVars)-len(vars))
+		for v, choice := range assign {
+			if choice == -1 {
+				order = append(order, v)
+			}
+		}
+		if !l.AllowsPartial(g.toCase(assign)) || !g.complete(assign, order, 0) {
+			klog.V(1).Infof("No allowed case contains %v, it will not be covered", g.toCase(tuple))
+			delete(g.uncovered, key)
+			continue
+		}
+		combinations(allVars, g.strength, func(combo []int) bool {
+			delete(g.uncovered, g.tupleKey(combo, assign))
+			return true
+		})
+		cases <- g.toCase(assign)
+	}
+}
+
+// SampleCases chooses n of the cases from in uniformly at random, and sends them to out in the order they were received,
+// closing out when finished. The same seed and sequence of incoming cases will always produce the same sample.
+func SampleCases(in <-chan Case, out chan<- Case, n int, seed int64) {
+	defer close(out)
+
+	type sampled struct {
+		ix int
+		c  Case
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+	reservoir := make([]sampled, 0, n)
+	ix := 0
+	for c := range in {
+		if len(reservoir) < n {
+			reservoir = append(reservoir, sampled{ix: ix, c: c})
+		} else if replace := rng.Intn(ix + 1); replace < n {
+			reservoir[replace] = sampled{ix: ix, c: c}
+		}
+		ix++
+	}
+
+	sort.Slice(reservoir, func(i, j int) bool { return reservoir[i].ix < reservoir[j].ix })
+	for _, s := range reservoir {
+		out <- s.c
+	}
+}
+
+// ShardCases splits the cases from in into count disjoint shards, and sends only the cases in the shard numbered index
+// (starting at zero) to out, closing out when finished. Cases are assigned to shards in a round-robin fashion, so as
+// long as every shard receives the same sequence of cases, the union of every shard is the full set of cases.
+func ShardCases(in <-chan Case, out chan<- Case, index, count int) {
+	defer close(out)
+
+	ix := 0
+	for c := range in {
+		if ix%count == index {
+			out <- c
+		}
+		ix++
+	}
+}
+
+// FilterCases sends only the cases from in for which keep returns true to out, closing out when finished
+func FilterCases(in <-chan Case, out chan<- Case, keep func(Case) bool) {
+	defer close(out)
+
+	for c := range in {
+		if keep(c) {
+			out <- c
+		}
+	}
+}
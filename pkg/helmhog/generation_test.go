@@ -0,0 +1,214 @@
+package helmhog
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const generationTestProject = `
+apiVersion: helm-hog.meln5674.github.com/v1alpha1
+kind: Project
+parts:
+  p: {}
+variables:
+  db: {postgres: [p], mysql: [p], sqlite: [p], none: [p]}
+  replicas: {one: [p], many: [p]}
+  storage: {local: [p], s3: [p], gcs: [p]}
+  tls: {disabled: [p], enabled: [p]}
+  ingress: {nginx: [p], traefik: [p], none: [p]}
+requirements:
+  many-replicas-need-external-db:
+    if: {replicas: many}
+    then: {db: [postgres, mysql]}
+restrictions:
+  no-tls-without-ingress: {tls: enabled, ingress: none}
+  no-local-storage-with-many-replicas: {storage: local, replicas: many}
+conditions:
+  sqlite-is-local: 'case.db != "sqlite" || case.storage == "local"'
+`
+
+// collectCases runs a generator and returns every case it sends
+func collectCases(generate func(chan<- Case)) []Case {
+	cases := make(chan Case)
+	go generate(cases)
+	collected := make([]Case, 0)
+	for c := range cases {
+		collected = append(collected, c)
+	}
+	return collected
+}
+
+// tupleIDs returns the IDs of every combination of choices for strength variables in a case
+func tupleIDs(l *LoadedProject, c Case, strength int) []string {
+	vars := make([]int, len(l.VariableOrder))
+	for v := range vars {
+		vars[v] = v
+	}
+	ids := make([]string, 0)
+	combinations(vars, strength, func(combo []int) bool {
+		tuple := make(Case, strength)
+		for _, v := range combo {
+			tuple[l.VariableOrder[v]] = c[l.VariableOrder[v]]
+		}
+		ids = append(ids, l.CaseID(tuple))
+		return true
+	})
+	return ids
+}
+
+func TestGeneratePairwise(t *testing.T) {
+	for _, strength := range []int{1, 2, 3, 5, 6} {
+		t.Run(fmt.Sprintf("strength %d", strength), func(t *testing.T) {
+			l := loadTestProject(t, generationTestProject+fmt.Sprintf("generation: {strategy: pairwise, strength: %d}\n", strength))
+			all := collectCases(l.generateExhaustive)
+			generated := collectCases(l.GenerateCases)
+
+			effectiveStrength := strength
+			if effectiveStrength > len(l.Variables) {
+				effectiveStrength = len(l.Variables)
+			}
+			covered := make(map[string]struct{})
+			seen := make(map[string]struct{}, len(generated))
+			for _, c := range generated {
+				id := l.CaseID(c)
+				if _, ok := seen[id]; ok {
+					t.Errorf("Generated %s more than once", id)
+				}
+				seen[id] = struct{}{}
+				if len(c) != len(l.Variables) || !l.Allows(c) {
+					t.Errorf("Generated %s, which is not an allowed case", id)
+				}
+				for _, tuple := range tupleIDs(l, c, effectiveStrength) {
+					covered[tuple] = struct{}{}
+				}
+			}
+			// Every combination which appears in any allowed case must be covered
+			allowed := make(map[string]struct{})
+			for _, c := range all {
+				for _, tuple := range tupleIDs(l, c, effectiveStrength) {
+					allowed[tuple] = struct{}{}
+					if _, ok := covered[tuple]; !ok {
+						t.Errorf("%s is allowed, but not covered", tuple)
+						covered[tuple] = struct{}{}
+					}
+				}
+			}
+			if len(covered) != len(allowed) {
+				t.Errorf("Covered %d combinations, but only %d are allowed", len(covered), len(allowed))
+			}
+			if len(generated) > len(all) {
+				t.Errorf("Generated %d cases, but there are only %d allowed cases", len(generated), len(all))
+			}
+			if strength < len(l.Variables) && len(generated) == len(all) {
+				t.Errorf("Generated every one of the %d allowed cases", len(all))
+			}
+
+			again := collectCases(l.GenerateCases)
+			if caseIDs(l, again) != caseIDs(l, generated) {
+				t.Errorf("Generation is not deterministic")
+			}
+		})
+	}
+}
+
+// caseIDs joins the IDs of a list of cases, in order
+func caseIDs(l *LoadedProject, cases []Case) string {
+	ids := make([]string, 0, len(cases))
+	for _, c := range cases {
+		ids = append(ids, l.CaseID(c))
+	}
+	return strings.Join(ids, " ")
+}
+
+// sendCases returns a channel which receives a list of cases, then is closed
+func sendCases(cases []Case) <-chan Case {
+	ch := make(chan Case)
+	go func() {
+		defer close(ch)
+		for _, c := range cases {
+			ch <- c
+		}
+	}()
+	return ch
+}
+
+func TestSampleCases(t *testing.T) {
+	l := loadTestProject(t, generationTestProject)
+	all := collectCases(l.generateExhaustive)
+	index := make(map[string]int, len(all))
+	for ix, c := range all {
+		index[l.CaseID(c)] = ix
+	}
+	tests := []struct {
+		n    int
+		seed int64
+		want int
+	}{
+		{n: 1, seed: 1, want: 1},
+		{n: 5, seed: 1, want: 5},
+		{n: 5, seed: 2, want: 5},
+		{n: len(all), seed: 1, want: len(all)},
+		{n: len(all) + 10, seed: 1, want: len(all)},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprintf("%d seed %d", test.n, test.seed), func(t *testing.T) {
+			sample := collectCases(func(out chan<- Case) { SampleCases(sendCases(all), out, test.n, test.seed) })
+			if len(sample) != test.want {
+				t.Fatalf("Sampled %d cases, want %d", len(sample), test.want)
+			}
+			last := -1
+			for _, c := range sample {
+				ix, ok := index[l.CaseID(c)]
+				if !ok {
+					t.Fatalf("Sampled %s, which was not an input", l.CaseID(c))
+				}
+				if ix <= last {
+					t.Fatalf("Sample is not in input order, or contains duplicates: %s", caseIDs(l, sample))
+				}
+				last = ix
+			}
+			again := collectCases(func(out chan<- Case) { SampleCases(sendCases(all), out, test.n, test.seed) })
+			if caseIDs(l, again) != caseIDs(l, sample) {
+				t.Errorf("Sampling is not deterministic")
+			}
+		})
+	}
+
+	one := collectCases(func(out chan<- Case) { SampleCases(sendCases(all), out, 5, 1) })
+	two := collectCases(func(out chan<- Case) { SampleCases(sendCases(all), out, 5, 2) })
+	if caseIDs(l, one) == caseIDs(l, two) {
+		t.Errorf("Different seeds produced the same sample")
+	}
+}
+
+func TestShardCases(t *testing.T) {
+	l := loadTestProject(t, generationTestProject)
+	all := collectCases(l.generateExhaustive)
+	for _, count := range []int{1, 2, 3, 7, len(all), len(all) + 1} {
+		t.Run(fmt.Sprintf("%d shards", count), func(t *testing.T) {
+			shardOf := make(map[string]int, len(all))
+			for index := 0; index < count; index++ {
+				shard := collectCases(func(out chan<- Case) { ShardCases(sendCases(all), out, index, count) })
+				if len(shard) > len(all)/count+1 {
+					t.Errorf("Shard %d has %d cases, more than its share of %d", index, len(shard), len(all))
+				}
+				for _, c := range shard {
+					id := l.CaseID(c)
+					if other, ok := shardOf[id]; ok {
+						t.Errorf("%s is in shards %d and %d", id, other, index)
+					}
+					shardOf[id] = index
+				}
+			}
+			for _, c := range all {
+				if _, ok := shardOf[l.CaseID(c)]; !ok {
+					t.Errorf("%s is not in any shard", l.CaseID(c))
+				}
+			}
+			if len(shardOf) != len(all) {
+				t.Errorf("Shards have %d cases, want %d", len(shardOf), len(all))
+			}
+		})
+	}
+}
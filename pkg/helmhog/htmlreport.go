@@ -0,0 +1,172 @@
+package helmhog
+
+import (
+	_ "embed"
+	"fmt"
+	"html/template"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	//go:embed report.html.tmpl
+	htmlReportTemplateText string
+	htmlReportTemplate     = template.Must(template.New("report.html").Parse(htmlReportTemplateText))
+)
+
+type htmlReport struct {
+	Project string
+	// ArtifactsDir is the directory the reports of each case are copied to, relative to the report
+	ArtifactsDir string
+	Start        time.Time
+	Duration     time.Duration
+	Totals       ChoiceSummary
+	Variables    []VariableName
+	MaxChoices   int
+	Matrix       []htmlReportVariable
+	Cases        []htmlReportCase
+}
+
+type htmlReportVariable struct {
+	Variable VariableName
+	Choices  []htmlReportChoice
+}
+
+type htmlReportChoice struct {
+	Choice   ChoiceName
+	Summary  *ChoiceSummary
+	PassRate string
+	Class    string
+}
+
+type htmlReportCase struct {
+	Choices         []ChoiceName
+	Status          CaseStatus
+	Duration        time.Duration
+	DurationSeconds float64
+	Hash            string
+	Error           string
+	Manifests       template.URL
+	Outputs         []htmlReportOutput
+}
+
+type htmlReportOutput struct {
+	Name     string
+	Contents string
+}
+
+// newHTMLReportChoice summarizes the pass rate of a choice for the matrix view
+func newHTMLReportChoice(choice ChoiceName, summary *ChoiceSummary) htmlReportChoice {
+	passed := summary.Passed + summary.ExpectedFailure
+	run := passed + summary.Failed
+	reportChoice := htmlReportChoice{Choice: choice, Summary: summary}
+	switch {
+	case run == 0:
+		reportChoice.PassRate = "not run"
+		reportChoice.Class = string(CaseStatusSkipped)
+	case summary.Failed == 0:
+		reportChoice.Class = string(CaseStatusPassed)
+	case passed == 0:
+		reportChoice.Class = string(CaseStatusFailed)
+	default:
+		reportChoice.Class = "mixed"
+	}
+	if run != 0 {
+		reportChoice.PassRate = fmt.Sprintf("%d/%d (%d%%)", passed, run, passed*100/run)
+	}
+	return reportChoice
+}
+
+// htmlReportOutputs returns the contents of every non-empty output file of a failed case, except for its rendered manifests,
+// which are linked to instead
+func (l *LoadedProject) htmlReportOutputs(c Case) []htmlReportOutput {
+	outputs := make([]htmlReportOutput, 0)
+	for _, path := range l.AllTempPaths(c) {
+		if path == l.TemplateOutPath(c) || path == l.CaseIDPath(c) {
+			continue
+		}
+		contents, err := os.ReadFile(path)
+		if err != nil || len(strings.TrimSpace(string(contents))) == 0 {
+			continue
+		}
+		outputs = append(outputs, htmlReportOutput{Name: filepath.Base(path), Contents: string(contents)})
+	}
+	return outputs
+}
+
+// newHTMLReport summarizes a set of results for an HTML report at path, copying the reports of each case into ReportArtifactsDir
+func (l *LoadedProject) newHTMLReport(path string, name string, start time.Time, results []CaseResult) (*htmlReport, error) {
+	summary := l.Summarize(results)
+	report := htmlReport{
+		Project:      name,
+		ArtifactsDir: filepath.Base(ReportArtifactsDir(path)),
+		Start:        start,
+		Duration:     time.Since(start).Round(time.Millisecond),
+		Variables:    l.VariableOrder,
+		Matrix:       make([]htmlReportVariable, 0, len(l.VariableOrder)),
+		Cases:        make([]htmlReportCase, 0, len(results)),
+	}
+	for _, variable := range l.VariableOrder {
+		choices := make([]ChoiceName, 0, len(summary[variable]))
+		for choice := range summary[variable] {
+			choices = append(choices, choice)
+		}
+		sort.Strings(choices)
+		if len(choices) > report.MaxChoices {
+			report.MaxChoices = len(choices)
+		}
+		reportVariable := htmlReportVariable{Variable: variable, Choices: make([]htmlReportChoice, 0, len(choices))}
+		for _, choice := range choices {
+			reportVariable.Choices = append(reportVariable.Choices, newHTMLReportChoice(choice, summary[variable][choice]))
+		}
+		report.Matrix = append(report.Matrix, reportVariable)
+	}
+	for _, result := range l.sortedResults(results) {
+		report.Totals.count(result.Status)
+		reportCase := htmlReportCase{
+			Choices:         make([]ChoiceName, 0, len(l.VariableOrder)),
+			Status:          result.Status,
+			Duration:        result.Duration.Round(time.Millisecond),
+			DurationSeconds: result.Duration.Seconds(),
+			Hash:            l.CaseHash(result.Case),
+			Error:           errorString(result.Err),
+		}
+		for _, variable := range l.VariableOrder {
+			reportCase.Choices = append(reportCase.Choices, result.Case[variable])
+		}
+		_, artifacts, err := l.copyReportArtifacts(path, result.Case)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("copy reports of case %s", l.CaseID(result.Case)))
+		}
+		if manifests, ok := artifacts[filepath.Base(l.TemplateOutPath(result.Case))]; ok {
+			reportCase.Manifests = template.URL((&url.URL{Path: filepath.ToSlash(manifests)}).String())
+		}
+		if result.Status.Failed() {
+			reportCase.Outputs = l.htmlReportOutputs(result.Case)
+		}
+		report.Cases = append(report.Cases, reportCase)
+	}
+	return &report, nil
+}
+
+// WriteHTMLReport writes a single HTML report to path, with a matrix of the pass rate of each choice of each variable,
+// and a sortable table of every case, including the output of each failed case and links to their rendered manifests.
+// The reports of each case are copied into ReportArtifactsDir, which the links point into.
+func (l *LoadedProject) WriteHTMLReport(path string, name string, start time.Time, results []CaseResult) error {
+	report, err := l.newHTMLReport(path, name, start, results)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return htmlReportTemplate.Execute(f, report)
+}
@@ -0,0 +1,66 @@
+package helmhog
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTMLReport(t *testing.T) {
+	l := loadTestProject(t, selectorTestProject)
+	results := reportTestResults(t, l)
+	reportPath := filepath.Join(t.TempDir(), "report.html")
+	report, err := l.newHTMLReport(reportPath, "hog.yaml", reportTestStart, results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// This depends on when the test is run
+	report.Duration = 62 * time.Second
+	var reportBytes bytes.Buffer
+	err = htmlReportTemplate.Execute(&reportBytes, report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "report.html", reportBytes.Bytes())
+
+	// Every link in the report is relative to it, and still exists once the temporary directory is removed
+	err = l.RemoveTempDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	links := 0
+	for _, reportCase := range report.Cases {
+		if reportCase.Manifests == "" {
+			continue
+		}
+		links++
+		_, err = os.Stat(filepath.Join(filepath.Dir(reportPath), string(reportCase.Manifests)))
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if links != 2 {
+		t.Errorf("Report links to the manifests of %d cases, want 2", links)
+	}
+}
+
+func TestWriteHTMLReport(t *testing.T) {
+	l := loadTestProject(t, selectorTestProject)
+	results := reportTestResults(t, l)
+	reportPath := filepath.Join(t.TempDir(), "report.html")
+	err := l.WriteHTMLReport(reportPath, "hog.yaml", reportTestStart, results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := os.ReadFile(reportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	link := `<a href="report-artifacts/` + l.CaseHash(results[0].Case) + `/template.out">`
+	if !strings.Contains(string(report), link) {
+		t.Errorf("Report does not contain %s", link)
+	}
+}
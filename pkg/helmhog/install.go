@@ -0,0 +1,177 @@
+package helmhog
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/meln5674/gosh"
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultInstallTimeout = 5 * time.Minute
+)
+
+// firstError is a gosh.SequenceGate which runs every command, even if earlier commands fail,
+// and fails with the first error, if any
+func firstError(s *gosh.SequenceCmd, ix int, err error, killed bool) (bool, error) {
+	if killed {
+		return false, err
+	}
+	if len(s.CmdErrors) != 0 {
+		return true, s.CmdErrors[0]
+	}
+	return true, nil
+}
+
+// Install installs a case into its own namespace in the current kube context, waits for it to become ready,
+// runs its tests, collects the resources, events, and pod logs in the namespace, then uninstalls it and deletes the namespace.
+// Diagnostics are collected and the release is removed even if installation or testing failed.
+// Installation always uses the helm command, regardless of engine.
+func (l *LoadedProject) Install(c Case, timeout time.Duration) gosh.Commander {
+	namespace := l.CaseNamespace(c)
+
+	install := []string{"helm", "install", releaseName, l.Chart, "--namespace", namespace, "--create-namespace", "--wait", "--timeout", timeout.String()}
+	install = append(install, l.Settings.HelmFlags...)
+	install = append(install, l.ValuesArgs(c)...)
+
+	test := []string{"helm", "test", releaseName, "--namespace", namespace, "--logs", "--timeout", timeout.String()}
+	test = append(test, l.Settings.HelmFlags...)
+
+	return gosh.Sequence(
+		firstError,
+		gosh.And(
+			gosh.Command(install...).WithStreams(gosh.FileOut(l.InstallOutPath(c)), gosh.FileErr(l.InstallErrPath(c))),
+			gosh.Command(test...).WithStreams(gosh.FileOut(l.HelmTestOutPath(c)), gosh.FileErr(l.HelmTestErrPath(c))),
+		),
+		l.collectDiagnostics(c),
+		l.InstallCleanup(c, timeout),
+	)
+}
+
+// InstallCleanup uninstalls a case and deletes its namespace. It is run by Install, and should be run separately
+// if Install is killed, e.g. because the case timed out.
+func (l *LoadedProject) InstallCleanup(c Case, timeout time.Duration) gosh.Commander {
+	namespace := l.CaseNamespace(c)
+
+	uninstall := []string{"helm", "uninstall", releaseName, "--namespace", namespace, "--wait", "--timeout", timeout.String()}
+	uninstall = append(uninstall, l.Settings.HelmFlags...)
+
+	return gosh.Sequence(
+		firstError,
+		gosh.Command(uninstall...).WithStreams(gosh.FileOut(l.UninstallOutPath(c)), gosh.FileErr(l.UninstallErrPath(c))),
+		l.deleteCaseNamespace(c),
+	)
+}
+
+// collectDiagnostics saves the resources, events, and pod logs in the namespace of a case to its report directory
+func (l *LoadedProject) collectDiagnostics(c Case) gosh.Commander {
+	namespace := l.CaseNamespace(c)
+
+	resources := []string{"kubectl", "get", "all", "--namespace", namespace, "--output", "wide"}
+	resources = append(resources, l.Settings.KubectlFlags...)
+
+	events := []string{"kubectl", "get", "events", "--namespace", namespace, "--sort-by", ".lastTimestamp"}
+	events = append(events, l.Settings.KubectlFlags...)
+
+	return gosh.FanOut(
+		gosh.Command(resources...).WithStreams(gosh.FileOut(l.ResourcesOutPath(c)), gosh.FileErr(l.ResourcesErrPath(c))),
+		gosh.Command(events...).WithStreams(gosh.FileOut(l.EventsOutPath(c)), gosh.FileErr(l.EventsErrPath(c))),
+		l.collectPodLogs(c).WithStreams(gosh.FileErr(l.PodLogsErrPath(c))),
+	)
+}
+
+// collectPodLogs saves the logs of every container of every pod in the namespace of a case to a file per pod
+func (l *LoadedProject) collectPodLogs(c Case) *gosh.FuncCmd {
+	return funcCommand(func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+		namespace := l.CaseNamespace(c)
+
+		list := []string{"kubectl", "get", "pods", "--namespace", namespace, "--output", "name"}
+		list = append(list, l.Settings.KubectlFlags...)
+		var pods string
+		err := gosh.Command(list...).WithContext(ctx).WithStreams(gosh.FuncOut(gosh.SaveString(&pods)), gosh.WriterErr(stderr)).Run()
+		if err != nil {
+			return errors.Wrap(err, "list pods")
+		}
+
+		err = os.MkdirAll(l.PodLogsDir(c), 0700)
+		if err != nil {
+			return err
+		}
+		failed := 0
+		for _, pod := range strings.Fields(pods) {
+			name := strings.TrimPrefix(pod, "pod/")
+			logs := []string{"kubectl", "logs", name, "--namespace", namespace, "--all-containers", "--prefix"}
+			logs = append(logs, l.Settings.KubectlFlags...)
+			err = gosh.Command(logs...).WithContext(ctx).WithStreams(gosh.FileOut(l.PodLogsPath(c, name)), gosh.WriterErr(stderr)).Run()
+			if err != nil {
+				failed++
+			}
+		}
+		if failed != 0 {
+			return fmt.Errorf("Failed to collect logs for %d pod(s)", failed)
+		}
+		return nil
+	})
+}
+
+func (l *LoadedProject) ValidateWithInstall(c Case, timeout time.Duration, stages *Stages) gosh.Commander {
+	return gosh.FanOut(stages.Command(ValidatorLint, l.Lint(c)), stages.Command(StageInstall, l.Install(c, timeout)))
+}
+
+func (l *LoadedProject) InstallOutPath(c Case) string {
+	return l.TempPath(c, "install.out")
+}
+
+func (l *LoadedProject) InstallErrPath(c Case) string {
+	return l.TempPath(c, "install.err")
+}
+
+func (l *LoadedProject) HelmTestOutPath(c Case) string {
+	return l.TempPath(c, "helm-test.out")
+}
+
+func (l *LoadedProject) HelmTestErrPath(c Case) string {
+	return l.TempPath(c, "helm-test.err")
+}
+
+func (l *LoadedProject) ResourcesOutPath(c Case) string {
+	return l.TempPath(c, "resources.out")
+}
+
+func (l *LoadedProject) ResourcesErrPath(c Case) string {
+	return l.TempPath(c, "resources.err")
+}
+
+func (l *LoadedProject) EventsOutPath(c Case) string {
+	return l.TempPath(c, "events.out")
+}
+
+func (l *LoadedProject) EventsErrPath(c Case) string {
+	return l.TempPath(c, "events.err")
+}
+
+func (l *LoadedProject) PodLogsDir(c Case) string {
+	return l.TempPath(c, "logs")
+}
+
+func (l *LoadedProject) PodLogsPath(c Case, pod string) string {
+	return filepath.Join(l.PodLogsDir(c), pod+".log")
+}
+
+func (l *LoadedProject) PodLogsErrPath(c Case) string {
+	return l.TempPath(c, "logs.err")
+}
+
+func (l *LoadedProject) UninstallOutPath(c Case) string {
+	return l.TempPath(c, "uninstall.out")
+}
+
+func (l *LoadedProject) UninstallErrPath(c Case) string {
+	return l.TempPath(c, "uninstall.err")
+}
@@ -0,0 +1,112 @@
+package helmhog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// A JSONReport is the machine-readable report of a test run
+type JSONReport struct {
+	Project string `json:"project"`
+	// TempDir is the directory the reports of each case were written to during the run, which is removed once the run
+	// finishes unless --keep-reports is set. The reports are copied next to the report, so that they are kept either way.
+	TempDir         string        `json:"tempDir"`
+	Start           time.Time     `json:"start"`
+	DurationSeconds float64       `json:"durationSeconds"`
+	Totals          ChoiceSummary `json:"totals"`
+	// Choices counts the results of the cases which used each choice of each variable
+	Choices map[VariableName]map[ChoiceName]*ChoiceSummary `json:"choices"`
+	// FailedChoices lists the choices of each variable which were used by at least one failed case
+	FailedChoices map[VariableName][]ChoiceName `json:"failedChoices"`
+	Cases         []JSONCaseReport              `json:"cases"`
+}
+
+// A JSONCaseReport is the result of a single case in a JSONReport
+type JSONCaseReport struct {
+	ID              string     `json:"id"`
+	Hash            string     `json:"hash"`
+	Mappings        MappingSet `json:"mappings"`
+	Status          CaseStatus `json:"status"`
+	DurationSeconds float64    `json:"durationSeconds"`
+	Error           string     `json:"error,omitempty"`
+	// Signature identifies the cause of a failed case, ignoring paths, line numbers, and values specific to the case
+	Signature string            `json:"signature,omitempty"`
+	Stages    []JSONStageReport `json:"stages"`
+	// ReportDir is the directory the files written for the case were copied to, relative to the directory containing the report,
+	// or empty if none were written
+	ReportDir string `json:"reportDir"`
+	// Artifacts are the paths of the copies of the files written for the case, relative to the directory containing the report,
+	// keyed by their names, e.g. template.out
+	Artifacts map[string]string `json:"artifacts"`
+}
+
+// A JSONStageReport is the result of a single stage of a case in a JSONReport
+type JSONStageReport struct {
+	Name            string  `json:"name"`
+	ExitStatus      int     `json:"exitStatus"`
+	DurationSeconds float64 `json:"durationSeconds"`
+	Error           string  `json:"error,omitempty"`
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// NewJSONReport creates the machine-readable report of a set of results, to be written to reportPath, with cases sorted by case ID.
+// The files written for each case are copied into ReportArtifactsDir, and each case refers to its copies.
+func (l *LoadedProject) NewJSONReport(reportPath, name string, start time.Time, results []CaseResult) (*JSONReport, error) {
+	summary := l.Summarize(results)
+	report := JSONReport{
+		Project:         name,
+		TempDir:         l.TempDir,
+		Start:           start,
+		DurationSeconds: time.Since(start).Seconds(),
+		Choices:         summary,
+		FailedChoices:   FailedChoices(summary),
+		Cases:           make([]JSONCaseReport, 0, len(results)),
+	}
+	for _, result := range l.sortedResults(results) {
+		report.Totals.count(result.Status)
+		reportDir, artifacts, err := l.copyReportArtifacts(reportPath, result.Case)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("copy reports of case %s", l.CaseID(result.Case)))
+		}
+		caseReport := JSONCaseReport{
+			ID:              l.CaseID(result.Case),
+			Hash:            l.CaseHash(result.Case),
+			Mappings:        MappingSet(result.Case),
+			Status:          result.Status,
+			DurationSeconds: result.Duration.Seconds(),
+			Error:           errorString(result.Err),
+			Signature:       l.FailureSignature(result.Case, result.Err),
+			Stages:          make([]JSONStageReport, 0, len(result.Stages)),
+			ReportDir:       reportDir,
+			Artifacts:       artifacts,
+		}
+		for _, stage := range result.Stages {
+			caseReport.Stages = append(caseReport.Stages, JSONStageReport{
+				Name:            stage.Name,
+				ExitStatus:      stage.ExitStatus,
+				DurationSeconds: stage.Duration.Seconds(),
+				Error:           errorString(stage.Err),
+			})
+		}
+		report.Cases = append(report.Cases, caseReport)
+	}
+	return &report, nil
+}
+
+func (r *JSONReport) Write(path string) error {
+	reportBytes, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "marshal report")
+	}
+	return os.WriteFile(path, reportBytes, 0644)
+}
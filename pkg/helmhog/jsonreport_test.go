@@ -0,0 +1,52 @@
+package helmhog
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJSONReport(t *testing.T) {
+	l := loadTestProject(t, selectorTestProject)
+	results := reportTestResults(t, l)
+	reportPath := filepath.Join(t.TempDir(), "report.json")
+	report, err := l.NewJSONReport(reportPath, "hog.yaml", reportTestStart, results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.TempDir != l.TempDir || report.DurationSeconds <= 0 {
+		t.Errorf("Report has temp dir %s and duration %f", report.TempDir, report.DurationSeconds)
+	}
+	// These depend on when and where the test is run
+	report.TempDir = "/tmp/helm-hog-test"
+	report.DurationSeconds = 62
+	err = report.Write(reportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reportBytes, err := os.ReadFile(reportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "report.json", reportBytes)
+
+	// Every artifact in the report is relative to it, and still exists once the temporary directory is removed
+	err = l.RemoveTempDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var read JSONReport
+	err = json.Unmarshal(reportBytes, &read)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range read.Cases {
+		for name, path := range c.Artifacts {
+			_, err = os.Stat(filepath.Join(filepath.Dir(reportPath), path))
+			if err != nil {
+				t.Errorf("Artifact %s of case %s: %v", name, c.ID, err)
+			}
+		}
+	}
+}
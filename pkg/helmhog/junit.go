@@ -0,0 +1,106 @@
+package helmhog
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// WriteJUnitReport writes a JUnit XML report with a single test suite with the given name, containing a test case
+// for each result, named by its case ID. Failures include the error output of each step of the case.
+// The files written for each case are copied into ReportArtifactsDir, and each test case refers to its copy.
+func (l *LoadedProject) WriteJUnitReport(path string, name string, start time.Time, results []CaseResult) error {
+	suite := junitTestSuite{
+		Name:      name,
+		Timestamp: start.Format(time.RFC3339),
+		Cases:     make([]junitTestCase, 0, len(results)),
+	}
+	var total time.Duration
+	for _, result := range l.sortedResults(results) {
+		total += result.Duration
+		artifactsDir, _, err := l.copyReportArtifacts(path, result.Case)
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("copy reports of case %s", l.CaseID(result.Case)))
+		}
+		testCase := junitTestCase{
+			Name:      l.CaseID(result.Case),
+			ClassName: name,
+			Time:      junitSeconds(result.Duration),
+			SystemOut: fmt.Sprintf("Hash: %s\n", l.CaseHash(result.Case)),
+		}
+		if artifactsDir != "" {
+			testCase.SystemOut += fmt.Sprintf("Reports: %s\n", artifactsDir)
+		}
+		switch result.Status {
+		case CaseStatusFailed, CaseStatusTimedOut:
+			suite.Failures++
+			message := "Case failed"
+			if result.Err != nil {
+				message = result.Err.Error()
+			}
+			testCase.Failure = &junitMessage{Message: message, Text: l.CaseErrorOutput(result.Case)}
+		case CaseStatusSkipped:
+			suite.Skipped++
+			testCase.Skipped = &junitMessage{Message: "Skipped because it was expected to fail for an already known reason, or because the run was stopped"}
+		case CaseStatusExpectedFailure:
+			testCase.SystemOut += "Failed as expected\n"
+		}
+		suite.Cases = append(suite.Cases, testCase)
+	}
+	suite.Tests = len(suite.Cases)
+	suite.Time = junitSeconds(total)
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.WriteString(xml.Header)
+	if err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(f)
+	encoder.Indent("", "  ")
+	err = encoder.Encode(junitTestSuites{Suites: []junitTestSuite{suite}})
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString("\n")
+	return err
+}
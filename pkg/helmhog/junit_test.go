@@ -0,0 +1,34 @@
+package helmhog
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteJUnitReport(t *testing.T) {
+	l := loadTestProject(t, selectorTestProject)
+	results := reportTestResults(t, l)
+	reportPath := filepath.Join(t.TempDir(), "report.xml")
+	err := l.WriteJUnitReport(reportPath, "hog.yaml", reportTestStart, results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := os.ReadFile(reportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "report.xml", report)
+
+	// Every path in the report is relative to it, and still exists once the temporary directory is removed
+	err = l.RemoveTempDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, result := range results[:4] {
+		_, err = os.Stat(filepath.Join(filepath.Dir(reportPath), "report-artifacts", l.CaseHash(result.Case), "case.id"))
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package helmhog
+
+import (
+	"math/rand"
+)
+
+const (
+	// DefaultMinimizeVerify is the default number of cases containing a culprit which are checked to reproduce its failure
+	DefaultMinimizeVerify = 20
+
+	// minimizeSampleAttempts is how many random cases are generated for each case containing a culprit which is needed,
+	// to allow for generated cases which are not allowed or are duplicates
+	minimizeSampleAttempts = 10
+	// minimizeSeed seeds the sampling of cases containing a culprit, so that the same culprits are always found
+	minimizeSeed = 1
+)
+
+// A Culprit is a minimal set of mappings which reproduces a failure
+type Culprit struct {
+	Signature string
+	// Example is the failed case which was minimized
+	Example Case
+	// Mappings is the smallest subset of the mappings of Example found which reproduces the failure
+	Mappings Case
+	// Failed is the number of cases known to have failed with the same signature
+	Failed int
+	// Total is the number of allowed cases containing Mappings, or 0 if there were too many to count them,
+	// and Verified is how many of those were run, all of which failed with the same signature
+	Total    int
+	Verified int
+}
+
+// A Minimizer searches for the culprits of failures by re-running cases which differ from a failed case
+type Minimizer struct {
+	Project *LoadedProject
+	// Run runs a case, and returns its failure signature, or an empty string if it passed, and whether or not it finished.
+	// A case which did not finish, e.g. because the run was stopped, has no signature.
+	Run func(Case) (string, bool)
+	// Verify is the maximum number of cases containing a culprit to run to check that they reproduce the failure
+	Verify int
+	// Known are the failure signatures of cases which have already been run, by case ID.
+	// Every case run by the minimizer which finishes is added to it.
+	Known map[string]string
+}
+
+// signature returns the failure signature of a case, running it if it is not known, and whether or not it is known
+func (m *Minimizer) signature(c Case) (string, bool) {
+	id := m.Project.CaseID(c)
+	if signature, ok := m.Known[id]; ok {
+		return signature, true
+	}
+	signature, finished := m.Run(c)
+	if !finished {
+		return "", false
+	}
+	m.Known[id] = signature
+	return signature, true
+}
+
+// containing returns up to limit allowed cases which contain a set of mappings, and how many such cases there are.
+// If there are more than limit*minimizeSampleAttempts cases which vary only in the unmapped variables, the cases are
+// instead chosen at random, without counting them, in which case the count is 0, and fewer than limit may be found.
+func (l *LoadedProject) containing(mappings Case, limit int) ([]Case, int) {
+	unmapped := make([]VariableName, 0, len(l.VariableOrder))
+	size := 1
+	for _, name := range l.VariableOrder {
+		if _, ok := mappings[name]; ok {
+			continue
+		}
+		unmapped = append(unmapped, name)
+		if size <= limit*minimizeSampleAttempts {
+			size *= len(l.ChoiceOrder[name])
+		}
+	}
+
+	if size > limit*minimizeSampleAttempts {
+		rng := rand.New(rand.NewSource(minimizeSeed))
+		found := make([]Case, 0, limit)
+		seen := make(map[string]struct{}, limit)
+		for attempt := 0; attempt < limit*minimizeSampleAttempts && len(found) < limit; attempt++ {
+			c := make(Case, len(l.VariableOrder))
+			for name, choice := range mappings {
+				c[name] = choice
+			}
+			for _, name := range unmapped {
+				choices := l.ChoiceOrder[name]
+				c[name] = choices[rng.Intn(len(choices))]
+			}
+			id := l.CaseID(c)
+			if _, ok := seen[id]; ok {
+				continue
+			}
+			seen[id] = struct{}{}
+			if l.Allows(c) {
+				found = append(found, c)
+			}
+		}
+		return found, 0
+	}
+
+	cases := make(chan Case)
+	go l.generateProduct(cases, func(c Case) bool {
+		for name, choice := range mappings {
+			if mapped, ok := c[name]; ok && mapped != choice {
+				return false
+			}
+		}
+		return true
+	})
+	found := make([]Case, 0)
+	total := 0
+	for c := range cases {
+		if !l.Allows(c) {
+			continue
+		}
+		total++
+		if len(found) < limit {
+			found = append(found, c)
+		}
+	}
+	return found, total
+}
+
+// Minimize finds a minimal set of mappings of a failed case which reproduces its failure.
+// Each variable, in VariableOrder, is removed from the mappings if changing it to any of its other choices, which is allowed,
+// still fails with the same signature. The remaining mappings are then checked against up to Verify of the allowed cases which
+// contain them, chosen at random if there are too many, and if any of those do not reproduce the failure, the first variable in which it differs from the failed case
+// is restored, and the mappings are checked again.
+// If any case does not finish, the search is stopped, and the culprit is every mapping of the failed case.
+func (m *Minimizer) Minimize(failed Case, signature string) *Culprit {
+	l := m.Project
+	mappings := make(Case, len(failed))
+	for name, choice := range failed {
+		mappings[name] = choice
+	}
+	stopped := func() *Culprit {
+		whole := make(Case, len(failed))
+		for name, choice := range failed {
+			whole[name] = choice
+		}
+		return &Culprit{Signature: signature, Example: failed, Mappings: whole, Total: 1, Verified: 1}
+	}
+	for _, name := range l.VariableOrder {
+		reproduces := true
+		for _, choice := range l.ChoiceOrder[name] {
+			if choice == failed[name] {
+				continue
+			}
+			candidate := failed.With(name, choice)
+			if !l.Allows(candidate) {
+				continue
+			}
+			candidateSignature, finished := m.signature(candidate)
+			if !finished {
+				return stopped()
+			}
+			if candidateSignature != signature {
+				reproduces = false
+				break
+			}
+		}
+		if reproduces {
+			delete(mappings, name)
+		}
+	}
+
+	for {
+		cases, total := l.containing(mappings, m.Verify)
+		var counterexample Case
+		for _, c := range cases {
+			caseSignature, finished := m.signature(c)
+			if !finished {
+				return stopped()
+			}
+			if caseSignature != signature {
+				counterexample = c
+				break
+			}
+		}
+		if counterexample == nil {
+			return &Culprit{
+				Signature: signature,
+				Example:   failed,
+				Mappings:  mappings,
+				Total:     total,
+				Verified:  len(cases),
+			}
+		}
+		for _, name := range l.VariableOrder {
+			if counterexample[name] != failed[name] {
+				mappings[name] = failed[name]
+				break
+			}
+		}
+	}
+}
+
+// MinimizeAll finds a culprit for each group of failures, by minimizing the first case in the group
+func (m *Minimizer) MinimizeAll(groups []*FailureGroup) []*Culprit {
+	culprits := make([]*Culprit, 0, len(groups))
+	for _, group := range groups {
+		culprit := m.Minimize(group.Cases[0], group.Signature)
+		culprit.Failed = len(group.Cases)
+		culprits = append(culprits, culprit)
+	}
+	return culprits
+}
@@ -0,0 +1,190 @@
+package helmhog
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const minimizeTestProject = `
+apiVersion: helm-hog.meln5674.github.com/v1alpha1
+kind: Project
+parts:
+  p: {}
+variables:
+  a: {ok: [p], bad: [p]}
+  b: {b1: [p], b2: [p], b3: [p]}
+  c: {c1: [p], c2: [p]}
+  d: {d1: [p], d2: [p]}
+restrictions:
+  no-b3-with-c2: {b: b3, c: c2}
+`
+
+func TestMinimize(t *testing.T) {
+	l := loadTestProject(t, minimizeTestProject)
+	tests := []struct {
+		name   string
+		fails  func(Case) bool
+		failed Case
+		want   Case
+	}{
+		{
+			name:   "single choice",
+			fails:  func(c Case) bool { return c["a"] == "bad" },
+			failed: Case{"a": "bad", "b": "b2", "c": "c1", "d": "d2"},
+			want:   Case{"a": "bad"},
+		},
+		{
+			name:   "pair of choices",
+			fails:  func(c Case) bool { return c["a"] == "bad" && c["c"] == "c2" },
+			failed: Case{"a": "bad", "b": "b1", "c": "c2", "d": "d1"},
+			want:   Case{"a": "bad", "c": "c2"},
+		},
+		{
+			// Every variable can be changed one at a time without passing, but verification finds passing cases,
+			// and restores the first variable they differ in each time, so the culprit is not always the smallest
+			name:   "restored by verification",
+			fails:  func(c Case) bool { return c["c"] == "c2" || (c["b"] != "b3" && c["d"] == "d1") },
+			failed: Case{"a": "ok", "b": "b1", "c": "c2", "d": "d1"},
+			want:   Case{"a": "ok", "c": "c2"},
+		},
+		{
+			name:   "every case",
+			fails:  func(Case) bool { return true },
+			failed: Case{"a": "ok", "b": "b1", "c": "c1", "d": "d1"},
+			want:   Case{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			run := 0
+			m := Minimizer{
+				Project: l,
+				Run: func(c Case) (string, bool) {
+					run++
+					if !l.Allows(c) {
+						t.Errorf("Ran case which is not allowed: %s", l.CaseID(c))
+					}
+					if test.fails(c) {
+						return "boom", true
+					}
+					return "", true
+				},
+				Verify: DefaultMinimizeVerify,
+				Known:  map[string]string{l.CaseID(test.failed): "boom"},
+			}
+			culprit := m.Minimize(test.failed, "boom")
+			if l.CaseID(culprit.Mappings) != l.CaseID(test.want) {
+				t.Errorf("Minimize() = %s, want %s", l.CaseID(culprit.Mappings), l.CaseID(test.want))
+			}
+			if culprit.Verified != culprit.Total {
+				t.Errorf("Only %d of %d cases containing the culprit were verified", culprit.Verified, culprit.Total)
+			}
+			cases, _ := l.containing(culprit.Mappings, culprit.Total)
+			for _, c := range cases {
+				if !test.fails(c) {
+					t.Errorf("%s contains the culprit, but passes", l.CaseID(c))
+				}
+			}
+			if run != len(m.Known)-1 {
+				t.Errorf("Ran %d cases, but only %d are known, so some were run more than once", run, len(m.Known)-1)
+			}
+		})
+	}
+}
+
+func TestMinimizeStopped(t *testing.T) {
+	l := loadTestProject(t, minimizeTestProject)
+	failed := Case{"a": "bad", "b": "b2", "c": "c1", "d": "d2"}
+	fails := func(c Case) bool { return c["a"] == "bad" }
+	stopAfter := 2
+	run := 0
+	m := Minimizer{
+		Project: l,
+		Run: func(c Case) (string, bool) {
+			run++
+			if run > stopAfter {
+				return "", false
+			}
+			if fails(c) {
+				return "boom", true
+			}
+			return "", true
+		},
+		Verify: DefaultMinimizeVerify,
+		Known:  map[string]string{l.CaseID(failed): "boom"},
+	}
+	culprit := m.Minimize(failed, "boom")
+	if l.CaseID(culprit.Mappings) != l.CaseID(failed) {
+		t.Errorf("Minimize() = %s when stopped, want the whole failed case %s", l.CaseID(culprit.Mappings), l.CaseID(failed))
+	}
+	if len(m.Known) != stopAfter+1 {
+		t.Errorf("%d cases are known after %d finished, so cases which did not finish were recorded", len(m.Known)-1, stopAfter)
+	}
+
+	// Once the cases can finish, the cases which did not finish before are run again, instead of being treated as passing
+	stopAfter = run + 100
+	culprit = m.Minimize(failed, "boom")
+	if l.CaseID(culprit.Mappings) != "a=bad" {
+		t.Errorf("Minimize() = %s, want a=bad", l.CaseID(culprit.Mappings))
+	}
+}
+
+func TestContainingIsBounded(t *testing.T) {
+	var project strings.Builder
+	project.WriteString(`
+apiVersion: helm-hog.meln5674.github.com/v1alpha1
+kind: Project
+parts:
+  p: {}
+variables:
+`)
+	// 4^16 cases, far too many to walk
+	for v := 0; v < 16; v++ {
+		fmt.Fprintf(&project, "  v%02d: {c1: [p], c2: [p], c3: [p], c4: [p]}\n", v)
+	}
+	project.WriteString(`
+restrictions:
+  no-c4: {v00: c4}
+`)
+	l := loadTestProject(t, project.String())
+
+	for _, mappings := range []Case{{}, {"v01": "c2"}, {"v00": "c4"}} {
+		cases, total := l.containing(mappings, DefaultMinimizeVerify)
+		if total != 0 {
+			t.Errorf("containing(%s) counted %d cases", l.CaseID(mappings), total)
+		}
+		if mappings["v00"] == "c4" {
+			if len(cases) != 0 {
+				t.Errorf("containing(%s) found %d cases which are not allowed", l.CaseID(mappings), len(cases))
+			}
+			continue
+		}
+		if len(cases) != DefaultMinimizeVerify {
+			t.Errorf("containing(%s) found %d cases, want %d", l.CaseID(mappings), len(cases), DefaultMinimizeVerify)
+		}
+		seen := make(map[string]struct{}, len(cases))
+		for _, c := range cases {
+			id := l.CaseID(c)
+			if _, ok := seen[id]; ok {
+				t.Errorf("containing(%s) found %s more than once", l.CaseID(mappings), id)
+			}
+			seen[id] = struct{}{}
+			if !l.Allows(c) || len(c) != len(l.Variables) {
+				t.Errorf("containing(%s) found %s, which is not an allowed case", l.CaseID(mappings), id)
+			}
+			for name, choice := range mappings {
+				if c[name] != choice {
+					t.Errorf("containing(%s) found %s, which does not contain it", l.CaseID(mappings), id)
+				}
+			}
+		}
+		again, _ := l.containing(mappings, DefaultMinimizeVerify)
+		for ix := range cases {
+			if l.CaseID(cases[ix]) != l.CaseID(again[ix]) {
+				t.Errorf("containing(%s) is not deterministic", l.CaseID(mappings))
+				break
+			}
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package helmhog
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -18,7 +19,8 @@ const (
 	V1Alpha1APIVersion = "helm-hog.meln5674.github.com/v1alpha1"
 	ProjectKind        = "Project"
 
-	TempDirParts = "parts"
+	TempDirParts   = "parts"
+	TempDirPattern = "helm-hog-*"
 )
 
 type PartsDirectory = string
@@ -28,17 +30,31 @@ type PartPath = string
 type ProjectSettings struct {
 	HelmFlags    []string
 	KubectlFlags []string
+	Engine       Engine
+	ApplyMode    ApplyMode
+	// SchemaDir, KubernetesVersion, and IgnoreMissingSchemas are only used with ApplyModeSchema
+	SchemaDir            string
+	KubernetesVersion    string
+	IgnoreMissingSchemas bool
 }
 
 type Project struct {
 	metav1.TypeMeta
-	Chart         string                    `json:"chart,omitempty"`
-	PartsDirs     []PartsDirectory          `json:"partsDirs,omitempty"`
-	Parts         map[PartName]Part         `json:"parts,omitempty"`
-	Variables     map[VariableName]Variable `json:"variables"`
-	VariableOrder []VariableName            `json:"variableOrder"`
-	Requirements  map[RuleName]Requirement  `json:"requirements,omitempty"`
-	Restrictions  map[RuleName]Restriction  `json:"restrictions,omitempty"`
+	Chart         string                       `json:"chart,omitempty"`
+	PartsDirs     []PartsDirectory             `json:"partsDirs,omitempty"`
+	Parts         map[PartName]Part            `json:"parts,omitempty"`
+	Variables     map[VariableName]Variable    `json:"variables"`
+	VariableOrder []VariableName               `json:"variableOrder"`
+	Requirements  map[RuleName]Requirement     `json:"requirements,omitempty"`
+	Restrictions  map[RuleName]Restriction     `json:"restrictions,omitempty"`
+	Conditions    map[RuleName]string          `json:"conditions,omitempty"`
+	Generation    Generation                   `json:"generation,omitempty"`
+	Selectors     map[SelectorName]string      `json:"selectors,omitempty"`
+	CRDs          []string                     `json:"crds,omitempty"`
+	Validators    []ValidatorName              `json:"validators,omitempty"`
+	Assertions    map[AssertionName]Assertion  `json:"assertions,omitempty"`
+	ExpectFailure map[RuleName]ExpectedFailure `json:"expectFailure,omitempty"`
+	Snapshots     SnapshotNormalization        `json:"snapshots,omitempty"`
 }
 
 func (p *Project) Allows(c Case) bool {
@@ -55,6 +71,22 @@ func (p *Project) Allows(c Case) bool {
 	return true
 }
 
+// AllowsPartial is like Allows, but only checks rules whose variables are all mapped by c,
+// meaning it will not reject a partial case which could still become an allowed case
+func (p *Project) AllowsPartial(c Case) bool {
+	for _, rule := range p.Requirements {
+		if c.Maps(rule.Variables()...) && !rule.Allows(c) {
+			return false
+		}
+	}
+	for _, rule := range p.Restrictions {
+		if c.Maps(rule.Variables()...) && !rule.Allows(c) {
+			return false
+		}
+	}
+	return true
+}
+
 func (p *Project) Load(settings ProjectSettings) (*LoadedProject, error) {
 	var err error
 	if p.APIVersion != V1Alpha1APIVersion {
@@ -74,25 +106,42 @@ func (p *Project) Load(settings ProjectSettings) (*LoadedProject, error) {
 		if len(v) == 0 {
 			return nil, fmt.Errorf("Variable %s has no choices", name)
 		}
+		if name == ConditionAllOf || name == ConditionAnyOf || name == ConditionNot {
+			return nil, fmt.Errorf("Variable %s has a reserved name", name)
+		}
+		// Names must also be expressible in selectors, where a variable is followed by = or !=, and choices are separated by |
+		if strings.ContainsAny(name, caseIDSeparator+caseIDMappingOperator+selectorNot) {
+			return nil, fmt.Errorf("Variable %s cannot contain %s, %s, or %s", name, caseIDSeparator, caseIDMappingOperator, selectorNot)
+		}
+		for choice := range v {
+			if strings.ContainsAny(choice, caseIDSeparator+caseIDMappingOperator+selectorChoiceSeparator) {
+				return nil, fmt.Errorf("Variable %s, Choice %s cannot contain %s, %s, or %s", name, choice, caseIDSeparator, caseIDMappingOperator, selectorChoiceSeparator)
+			}
+		}
 	}
 
 	for name, rule := range p.Requirements {
-		if len(rule.If) == 0 {
+		if rule.If.IsEmpty() {
 			return nil, fmt.Errorf("Requirement %s has an empty 'if', it will match all cases", name)
 		}
-		if len(rule.Then) == 0 {
+		if rule.Then.IsEmpty() {
 			return nil, fmt.Errorf("Requirment %s has an empty 'then', it will never discard any cases", name)
 		}
 	}
 	for name, rule := range p.Restrictions {
-		if len(rule) == 0 {
+		if rule.IsEmpty() {
 			return nil, fmt.Errorf("Restriction %s is empty, it will discard all cases", name)
 		}
 	}
 
 	l := LoadedProject{Project: p}
 
-	l.TempDir, err = os.MkdirTemp("", "helm-hog-*")
+	l.Generation, err = p.Generation.Resolve()
+	if err != nil {
+		return nil, err
+	}
+
+	l.TempDir, err = os.MkdirTemp("", TempDirPattern)
 	if err != nil {
 		return nil, errors.Wrap(err, "create project temp directory")
 	}
@@ -179,52 +228,69 @@ func (p *Project) Load(settings ProjectSettings) (*LoadedProject, error) {
 	}
 
 	for ruleName, rule := range p.Requirements {
-		err = func() error {
-			for varName, choiceName := range rule.If {
-				if _, ok := p.Variables[varName]; !ok {
-					return fmt.Errorf("Requirement %s If refers to undefined variable %s", ruleName, varName)
-				}
-				if _, ok := p.Variables[varName][choiceName]; !ok {
-					return fmt.Errorf("Requirment %s If for variable %s refers to non-existent choice %s", ruleName, varName, choiceName)
-				}
-			}
-			for varName, choiceName := range rule.Then {
-				if _, ok := p.Variables[varName]; !ok {
-					return fmt.Errorf("Requirement %s Then refers to undefined variable %s", ruleName, varName)
-				}
-				if _, ok := p.Variables[varName][choiceName]; !ok {
-					return fmt.Errorf("Requirment %s Then for variable %s refers to non-existent choice %s", ruleName, varName, choiceName)
-				}
-			}
-			return nil
-		}()
+		err = rule.If.Check(p)
 		if err != nil {
-			return nil, err
+			return nil, errors.Wrap(err, fmt.Sprintf("Requirement %s If is invalid", ruleName))
+		}
+		err = rule.Then.Check(p)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Requirement %s Then is invalid", ruleName))
 		}
 	}
 
 	for ruleName, rule := range p.Restrictions {
-		err = func() error {
-			for varName, choiceName := range rule {
-				if _, ok := p.Variables[varName]; !ok {
-					return fmt.Errorf("Restriction %s refers to undefined variable %s", ruleName, varName)
-				}
-				if _, ok := p.Variables[varName][choiceName]; !ok {
-					return fmt.Errorf("Restriction %s for variable %s refers to non-existent choice %s", ruleName, varName, choiceName)
-				}
-			}
-			return nil
-		}()
+		err = rule.Check(p)
 		if err != nil {
-			return nil, err
+			return nil, errors.Wrap(err, fmt.Sprintf("Restriction %s is invalid", ruleName))
+		}
+	}
+
+	l.Conditions = make(map[RuleName]*Expression, len(p.Conditions))
+	for ruleName, source := range p.Conditions {
+		l.Conditions[ruleName], err = CompileExpression(p, source)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Condition %s is invalid", ruleName))
+		}
+	}
+
+	l.Assertions = make(map[AssertionName]*CompiledAssertion, len(p.Assertions))
+	for name, assertion := range p.Assertions {
+		assertion := assertion
+		l.Assertions[name], err = CompileAssertion(p, name, &assertion)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Assertion %s is invalid", name))
 		}
 	}
 
+	l.ExpectFailure = make(map[RuleName]*CompiledExpectedFailure, len(p.ExpectFailure))
+	for name, expected := range p.ExpectFailure {
+		expected := expected
+		l.ExpectFailure[name], err = CompileExpectedFailure(p, name, &expected)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Expected failure %s is invalid", name))
+		}
+	}
+
+	l.Selectors = make(map[SelectorName]Selector, len(p.Selectors))
+	for name, expr := range p.Selectors {
+		var selector Selector
+		selector, err = ParseSelector(expr)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Selector %s is invalid", name))
+		}
+		err = selector.Check(p)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("Selector %s is invalid", name))
+		}
+		l.Selectors[name] = selector
+	}
+
 	l.VariableOrder = make([]VariableName, 0, len(p.Variables))
 	if len(p.VariableOrder) == 0 {
 		for name := range p.Variables {
 			l.VariableOrder = append(l.VariableOrder, name)
 		}
+		sort.Strings(l.VariableOrder)
 	} else {
 		missingVariables := make(map[VariableName]struct{}, len(p.Variables))
 		for name := range p.Variables {
@@ -240,11 +306,20 @@ func (p *Project) Load(settings ProjectSettings) (*LoadedProject, error) {
 			return nil, err
 		}
 	}
-	l.ReverseVariableOrder = make([]VariableName, len(p.Variables))
+	l.ReverseVariableOrder = make([]VariableName, len(l.VariableOrder))
 	for ix := range l.VariableOrder {
-		l.ReverseVariableOrder[ix] = l.VariableOrder[ix]
+		l.ReverseVariableOrder[len(l.VariableOrder)-1-ix] = l.VariableOrder[ix]
+	}
+
+	l.ChoiceOrder = make(map[VariableName][]ChoiceName, len(p.Variables))
+	for name, choices := range p.Variables {
+		order := make([]ChoiceName, 0, len(choices))
+		for choice := range choices {
+			order = append(order, choice)
+		}
+		sort.Strings(order)
+		l.ChoiceOrder[name] = order
 	}
-	sort.Sort(sort.Reverse(sort.StringSlice(l.ReverseVariableOrder)))
 
 	if p.Chart == "" {
 		l.Chart = "."
@@ -253,6 +328,66 @@ func (p *Project) Load(settings ProjectSettings) (*LoadedProject, error) {
 	}
 
 	l.Settings = settings
+	switch l.Settings.Engine {
+	case "":
+		l.Settings.Engine = DefaultEngine
+	case EngineCLI:
+	case EngineSDK:
+		if len(l.Settings.HelmFlags) != 0 {
+			err = fmt.Errorf("Extra helm flags cannot be used with the %s engine", EngineSDK)
+			return nil, err
+		}
+	default:
+		err = fmt.Errorf("Unknown engine %s", l.Settings.Engine)
+		return nil, err
+	}
+	l.sdk = new(sdkState)
+
+	switch l.Settings.ApplyMode {
+	case "":
+		l.Settings.ApplyMode = DefaultApplyMode
+	case ApplyModeClient, ApplyModeServer:
+	case ApplyModeSchema:
+		if l.Settings.SchemaDir == "" && !l.Settings.IgnoreMissingSchemas {
+			err = fmt.Errorf("A schema directory is required with the %s apply mode", ApplyModeSchema)
+			return nil, err
+		}
+		if l.Settings.KubernetesVersion == "" {
+			l.Settings.KubernetesVersion = DefaultKubernetesVersion
+		}
+		l.schema = new(schemaState)
+		err = l.loadCRDs()
+		if err != nil {
+			return nil, err
+		}
+	default:
+		err = fmt.Errorf("Unknown apply mode %s", l.Settings.ApplyMode)
+		return nil, err
+	}
+
+	validatorNames := p.Validators
+	if len(validatorNames) == 0 {
+		validatorNames = DefaultValidators
+	}
+	l.Validators = make([]Validator, 0, len(validatorNames))
+	seenValidators := make(map[ValidatorName]struct{}, len(validatorNames))
+	for _, name := range validatorNames {
+		if _, ok := seenValidators[name]; ok {
+			err = fmt.Errorf("Validator %s is listed more than once", name)
+			return nil, err
+		}
+		seenValidators[name] = struct{}{}
+		var validator Validator
+		validator, err = l.NewValidator(name)
+		if err != nil {
+			return nil, err
+		}
+		l.Validators = append(l.Validators, validator)
+	}
+	if _, ok := seenValidators[ValidatorAssertions]; !ok && len(l.Assertions) != 0 {
+		err = fmt.Errorf("Assertions are defined, but the %s validator is not listed", ValidatorAssertions)
+		return nil, err
+	}
 
 	return &l, nil
 }
@@ -266,80 +401,188 @@ type LoadedProject struct {
 
 	VariableOrder        []VariableName
 	ReverseVariableOrder []VariableName
+	ChoiceOrder          map[VariableName][]ChoiceName
+
+	Generation Generation
+
+	Conditions map[RuleName]*Expression
+
+	Selectors map[SelectorName]Selector
+
+	Assertions map[AssertionName]*CompiledAssertion
+
+	ExpectFailure map[RuleName]*CompiledExpectedFailure
 
 	PartsMapping map[PartName]PartPath
+
+	Validators []Validator
+
+	sdk    *sdkState
+	schema *schemaState
+}
+
+// Allows is like Project.Allows, but also checks the project's conditions
+func (l *LoadedProject) Allows(c Case) bool {
+	if !l.Project.Allows(c) {
+		return false
+	}
+	for _, rule := range l.Conditions {
+		if !rule.Allows(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// AllowsPartial is like Project.AllowsPartial, but also checks the project's conditions
+func (l *LoadedProject) AllowsPartial(c Case) bool {
+	if !l.Project.AllowsPartial(c) {
+		return false
+	}
+	for _, rule := range l.Conditions {
+		if c.Maps(rule.Variables()...) && !rule.Allows(c) {
+			return false
+		}
+	}
+	return true
 }
 
 func (l *LoadedProject) GenerateCases(cases chan<- Case) {
-	outgoing := cases
-	for _, name := range l.ReverseVariableOrder {
-		choices := l.Variables[name]
-		incoming := make(chan Case)
-		go func(name string, choices Variable, incoming <-chan Case, outgoing chan<- Case) {
-			for c := range incoming {
-				for choice := range choices {
-					newC := c.With(name, choice)
-					if !l.Allows(newC) {
-						continue
-					}
-					outgoing <- newC
-				}
-			}
-			close(outgoing)
-		}(name, choices, incoming, outgoing)
-		outgoing = incoming
+	switch l.Generation.Strategy {
+	case GenerationStrategyPairwise:
+		l.generatePairwise(cases)
+	default:
+		l.generateExhaustive(cases)
 	}
+}
 
-	outgoing <- Case{}
-	close(outgoing)
+// CaseParts returns the parts of every choice in a case, in VariableOrder
+func (l *LoadedProject) CaseParts(c Case) []PartName {
+	parts := []PartName{}
+	for _, name := range l.VariableOrder {
+		parts = append(parts, l.Variables[name][c[name]]...)
+	}
+	return parts
 }
 
 func (l *LoadedProject) ValuesArgs(c Case) []string {
 	args := []string{}
-	for name, choice := range c {
-		for _, part := range l.Variables[name][choice] {
-			args = append(args, "--values", l.PartsMapping[part])
-		}
+	for _, part := range l.CaseParts(c) {
+		args = append(args, "--values", l.PartsMapping[part])
 	}
 	return args
 }
 
 func (l *LoadedProject) Lint(c Case) gosh.Commander {
+	if l.Settings.Engine == EngineSDK {
+		return l.sdkLint(c).WithStreams(gosh.FileOut(l.LintOutPath(c)), gosh.FileErr(l.LintErrPath(c)))
+	}
 	cmd := []string{"helm", "lint", l.Chart}
 	cmd = append(cmd, l.Settings.HelmFlags...)
 	cmd = append(cmd, l.ValuesArgs(c)...)
 	return gosh.Command(cmd...).WithStreams(gosh.FileOut(l.LintOutPath(c)), gosh.FileErr(l.LintErrPath(c)))
 }
 
-func (l *LoadedProject) ApplyDryRun(c Case) gosh.Commander {
-	template := l.template(c)
-	apply := []string{"kubectl", "apply", "-f", "-", "--dry-run=client"}
-	apply = append(apply, l.Settings.KubectlFlags...)
-	return gosh.Pipeline(
-		template,
-		gosh.Command("tee", l.TemplateOutPath(c)).WithStreams(gosh.FileErr(l.TeeErrPath(c))),
-		gosh.Command(apply...).WithStreams(gosh.FileOut(l.ApplyOutPath(c)), gosh.FileErr(l.ApplyErrPath(c))),
-	)
-}
-
-func (l *LoadedProject) template(c Case) *gosh.Cmd {
+func (l *LoadedProject) template(c Case) gosh.Pipelineable {
+	if l.Settings.Engine == EngineSDK {
+		return l.sdkTemplate(c).WithStreams(gosh.FileErr(l.TemplateErrPath(c)))
+	}
 	template := []string{"helm", "template", l.Chart, "--debug"}
+	if namespace := l.renderNamespace(c); namespace != "" {
+		template = append(template, "--namespace", namespace)
+	}
 	template = append(template, l.Settings.HelmFlags...)
 	template = append(template, l.ValuesArgs(c)...)
 	return gosh.Command(template...).WithStreams(gosh.FileErr(l.TemplateErrPath(c)))
 }
 
 func (l *LoadedProject) Template(c Case) gosh.Commander {
-	return l.template(c).WithStreams(gosh.FileOut(l.TemplateOutPath(c)))
+	template := l.template(c)
+	gosh.FileOut(l.TemplateOutPath(c))(template)
+	return template
 }
 
-func (l *LoadedProject) ValidateWithApply(c Case) gosh.Commander {
+// RunContext runs a command, killing it if the context is done before it finishes, in which case the context's error is returned.
+// Commands which use the SDK engine cannot be interrupted, and are waited for after being killed.
+// Sequences are run one command at a time by runSequence instead of being started, because a gosh.SequenceCmd can only
+// be killed between its commands.
+func RunContext(ctx context.Context, cmd gosh.Commander) error {
+	err := ctx.Err()
+	if err != nil {
+		return err
+	}
+	if s, ok := cmd.(*gosh.SequenceCmd); ok {
+		return runSequence(ctx, s)
+	}
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case err = <-done:
+		return err
+	case <-ctx.Done():
+		cmd.Kill()
+		<-done
+		return ctx.Err()
+	}
+}
 
-	return gosh.FanOut(l.Lint(c), l.ApplyDryRun(c))
+// runSequence runs the commands of a sequence with RunContext, consulting its gate after each one as gosh would.
+// If the context is done while a command is running, that command is killed, the gate is told so, and the context's error is returned.
+// Sequences built by this package do not set their own streams, so their deferred functions, which are not accessible, are not needed.
+func runSequence(ctx context.Context, s *gosh.SequenceCmd) error {
+	if s.BuilderError != nil {
+		return s.BuilderError
+	}
+	var err error
+	for ix, cmd := range s.Cmds {
+		err = RunContext(ctx, cmd)
+		if ctx.Err() != nil {
+			s.Gate(s, ix, gosh.ErrKilled, true)
+			return ctx.Err()
+		}
+		if err != nil {
+			s.CmdErrors = append(s.CmdErrors, err)
+		}
+		var continu bool
+		continu, err = s.Gate(s, ix, err, false)
+		if !continu {
+			break
+		}
+	}
+	return err
 }
 
-func (l *LoadedProject) Validate(c Case) gosh.Commander {
-	return gosh.FanOut(l.Lint(c), l.Template(c))
+// RemoveTempDir removes the project's temp directory, except for any of the named entries within it,
+// in which case only the other entries are removed
+func (l *LoadedProject) RemoveTempDir(keep ...string) error {
+	if len(keep) == 0 {
+		return os.RemoveAll(l.TempDir)
+	}
+	entries, err := os.ReadDir(l.TempDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		kept := false
+		for _, name := range keep {
+			if entry.Name() == name {
+				kept = true
+				break
+			}
+		}
+		if kept {
+			continue
+		}
+		err = os.RemoveAll(filepath.Join(l.TempDir, entry.Name()))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (l *LoadedProject) CaseTempDirParts(c Case) []string {
@@ -351,7 +594,11 @@ func (l *LoadedProject) CaseTempDirParts(c Case) []string {
 }
 
 func (l *LoadedProject) MakeCaseTempDir(c Case) error {
-	return os.MkdirAll(filepath.Join(l.CaseTempDirParts(c)...), 0700)
+	err := os.MkdirAll(filepath.Join(l.CaseTempDirParts(c)...), 0700)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(l.CaseIDPath(c), []byte(l.CaseID(c)+"\n"), 0600)
 }
 
 func (l *LoadedProject) TempPath(c Case, then ...string) string {
@@ -360,6 +607,10 @@ func (l *LoadedProject) TempPath(c Case, then ...string) string {
 	return filepath.Join(parts...)
 }
 
+func (l *LoadedProject) CaseIDPath(c Case) string {
+	return l.TempPath(c, "case.id")
+}
+
 func (l *LoadedProject) LintOutPath(c Case) string {
 	return l.TempPath(c, "lint.out")
 }
@@ -372,10 +623,6 @@ func (l *LoadedProject) TemplateOutPath(c Case) string {
 	return l.TempPath(c, "template.out")
 }
 
-func (l *LoadedProject) TeeErrPath(c Case) string {
-	return l.TempPath(c, "tee.err")
-}
-
 func (l *LoadedProject) TemplateErrPath(c Case) string {
 	return l.TempPath(c, "template.err")
 }
@@ -388,14 +635,48 @@ func (l *LoadedProject) ApplyErrPath(c Case) string {
 	return l.TempPath(c, "apply.err")
 }
 
+func (l *LoadedProject) CreateNamespaceOutPath(c Case) string {
+	return l.TempPath(c, "create-namespace.out")
+}
+
+func (l *LoadedProject) CreateNamespaceErrPath(c Case) string {
+	return l.TempPath(c, "create-namespace.err")
+}
+
+func (l *LoadedProject) DeleteNamespaceOutPath(c Case) string {
+	return l.TempPath(c, "delete-namespace.out")
+}
+
+func (l *LoadedProject) DeleteNamespaceErrPath(c Case) string {
+	return l.TempPath(c, "delete-namespace.err")
+}
+
 func (l *LoadedProject) AllTempPaths(c Case) []string {
 	return []string{
+		l.CaseIDPath(c),
 		l.LintOutPath(c),
 		l.LintErrPath(c),
 		l.TemplateOutPath(c),
 		l.TemplateErrPath(c),
-		l.TeeErrPath(c),
 		l.ApplyOutPath(c),
 		l.ApplyErrPath(c),
+		l.CreateNamespaceOutPath(c),
+		l.CreateNamespaceErrPath(c),
+		l.DeleteNamespaceOutPath(c),
+		l.DeleteNamespaceErrPath(c),
+		l.FindingsPath(c),
+		l.SnapshotDiffPath(c),
+		l.InstallOutPath(c),
+		l.InstallErrPath(c),
+		l.HelmTestOutPath(c),
+		l.HelmTestErrPath(c),
+		l.ResourcesOutPath(c),
+		l.ResourcesErrPath(c),
+		l.EventsOutPath(c),
+		l.EventsErrPath(c),
+		l.PodLogsDir(c),
+		l.PodLogsErrPath(c),
+		l.UninstallOutPath(c),
+		l.UninstallErrPath(c),
 	}
 }
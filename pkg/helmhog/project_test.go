@@ -0,0 +1,99 @@
+package helmhog
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/meln5674/gosh"
+	"sigs.k8s.io/yaml"
+)
+
+// loadTestProject loads a project from YAML, removing its temp directory when the test finishes
+func loadTestProject(t *testing.T, project string) *LoadedProject {
+	t.Helper()
+	return loadTestProjectWithSettings(t, project, ProjectSettings{})
+}
+
+// loadTestProjectWithSettings is loadTestProject with settings other than the defaults
+func loadTestProjectWithSettings(t *testing.T, project string, settings ProjectSettings) *LoadedProject {
+	t.Helper()
+	p := new(Project)
+	err := yaml.Unmarshal([]byte(project), p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := p.Load(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.RemoveTempDir() })
+	return l
+}
+
+func TestRunContextKillsSequence(t *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("sleep is not available")
+	}
+	tests := []struct {
+		name string
+		cmd  func() gosh.Commander
+	}{
+		{
+			name: "last command",
+			cmd: func() gosh.Commander {
+				return gosh.Sequence(firstError, gosh.Command("true"), gosh.Command("sleep", "60"))
+			},
+		},
+		{
+			name: "nested and",
+			cmd: func() gosh.Commander {
+				return gosh.Sequence(firstError, gosh.And(gosh.Command("sleep", "60"), gosh.Command("true")), gosh.Command("true"))
+			},
+		},
+		{
+			name: "stage in fan out",
+			cmd: func() gosh.Commander {
+				var stages *Stages
+				return gosh.FanOut(stages.Command("sleep", gosh.Sequence(firstError, gosh.Command("sleep", "60"))))
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			done := make(chan error, 1)
+			go func() { done <- RunContext(ctx, test.cmd()) }()
+			select {
+			case err := <-done:
+				if !errors.Is(err, context.DeadlineExceeded) {
+					t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatal("sequence was not killed when the context timed out")
+			}
+		})
+	}
+}
+
+func TestRunContextSequenceGate(t *testing.T) {
+	var ran []int
+	step := func(ix int, err error) gosh.Commander {
+		return funcCommand(func(context.Context, io.Reader, io.Writer, io.Writer) error {
+			ran = append(ran, ix)
+			return err
+		})
+	}
+	failed := errors.New("failed")
+	err := RunContext(context.Background(), gosh.Sequence(firstError, step(0, nil), step(1, failed), step(2, nil)))
+	if !errors.Is(err, failed) {
+		t.Fatalf("expected %v, got %v", failed, err)
+	}
+	if len(ran) != 3 {
+		t.Fatalf("expected every command to run, ran %v", ran)
+	}
+}
@@ -0,0 +1,198 @@
+package helmhog
+
+import (
+	"fmt"
+	"sync"
+)
+
+type PruneMode string
+
+const (
+	// PruneNone runs every case
+	PruneNone PruneMode = "none"
+	// PruneChoices skips cases which share any choice with a failed case
+	PruneChoices PruneMode = "choices"
+	// PruneCulprits skips cases which contain the minimized culprit of a failure
+	PruneCulprits PruneMode = "culprits"
+
+	DefaultPruneMode = PruneNone
+	// DefaultPruneBatchSize is the default number of cases which are run before the known-bad mappings are updated
+	DefaultPruneBatchSize = 16
+)
+
+// KnownBad is a set of partial mappings known to cause failures, which may be shared between workers
+type KnownBad struct {
+	lock    sync.RWMutex
+	project *LoadedProject
+	ids     map[string]struct{}
+	// mappings are kept in the order they were added, so that the same mappings are matched regardless of map ordering
+	mappings []Case
+}
+
+func NewKnownBad(l *LoadedProject) *KnownBad {
+	return &KnownBad{project: l, ids: make(map[string]struct{})}
+}
+
+// Add records a set of mappings as known to cause failures
+func (k *KnownBad) Add(mappings Case) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	id := k.project.CaseID(mappings)
+	if _, ok := k.ids[id]; ok {
+		return
+	}
+	k.ids[id] = struct{}{}
+	k.mappings = append(k.mappings, mappings)
+}
+
+// Match returns the first set of known-bad mappings which a case contains, if any
+func (k *KnownBad) Match(c Case) (Case, bool) {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+	for _, mappings := range k.mappings {
+		contains := true
+		for name, choice := range mappings {
+			if c[name] != choice {
+				contains = false
+				break
+			}
+		}
+		if contains {
+			return mappings, true
+		}
+	}
+	return nil, false
+}
+
+// A PruningScheduler decides which cases to skip because they are expected to fail for a reason which is already known.
+// Cases are run in batches, and only failures from earlier batches are used to decide which cases in a batch to skip,
+// so that the same cases are skipped regardless of how many cases are run in parallel.
+type PruningScheduler struct {
+	Project   *LoadedProject
+	Mode      PruneMode
+	BatchSize int
+	KnownBad  *KnownBad
+	// Minimizer is used to find culprits with PruneCulprits. Its Known signatures are updated with every recorded result.
+	Minimizer *Minimizer
+}
+
+// Check ensures the scheduler's mode and batch size are valid
+func (s *PruningScheduler) Check() error {
+	switch s.Mode {
+	case PruneNone, PruneChoices:
+	case PruneCulprits:
+		if s.Minimizer == nil {
+			return fmt.Errorf("Pruning by culprits requires a minimizer")
+		}
+	default:
+		return fmt.Errorf("Unknown prune mode %s, must be one of %s, %s, %s", s.Mode, PruneNone, PruneChoices, PruneCulprits)
+	}
+	if s.BatchSize < 1 {
+		return fmt.Errorf("Prune batch size must be at least 1")
+	}
+	return nil
+}
+
+// Order returns the cases in the order they should be run so that failures are discovered early. Cases are greedily
+// chosen to cover as many choices as possible which no earlier case has, until every choice is covered, followed by
+// the remaining cases in their original order.
+func (s *PruningScheduler) Order(cases []Case) []Case {
+	uncovered := make(map[VariableName]map[ChoiceName]struct{}, len(s.Project.Variables))
+	for _, c := range cases {
+		for name, choice := range c {
+			if uncovered[name] == nil {
+				uncovered[name] = make(map[ChoiceName]struct{})
+			}
+			uncovered[name][choice] = struct{}{}
+		}
+	}
+	used := make([]bool, len(cases))
+	ordered := make([]Case, 0, len(cases))
+	for {
+		best := -1
+		bestCovers := 0
+		for ix, c := range cases {
+			if used[ix] {
+				continue
+			}
+			covers := 0
+			for name, choice := range c {
+				if _, ok := uncovered[name][choice]; ok {
+					covers++
+				}
+			}
+			if covers > bestCovers {
+				best = ix
+				bestCovers = covers
+			}
+		}
+		if best == -1 {
+			break
+		}
+		used[best] = true
+		ordered = append(ordered, cases[best])
+		for name, choice := range cases[best] {
+			delete(uncovered[name], choice)
+		}
+	}
+	for ix, c := range cases {
+		if !used[ix] {
+			ordered = append(ordered, c)
+		}
+	}
+	return ordered
+}
+
+// Batches splits ordered cases into the batches they should be run in
+func (s *PruningScheduler) Batches(cases []Case) [][]Case {
+	batches := make([][]Case, 0, len(cases)/s.BatchSize+1)
+	for start := 0; start < len(cases); start += s.BatchSize {
+		end := start + s.BatchSize
+		if end > len(cases) {
+			end = len(cases)
+		}
+		batches = append(batches, cases[start:end])
+	}
+	return batches
+}
+
+// Prune returns the known-bad mappings a case contains, if it should be skipped
+func (s *PruningScheduler) Prune(c Case) (Case, bool) {
+	if s.Mode == PruneNone {
+		return nil, false
+	}
+	return s.KnownBad.Match(c)
+}
+
+// Record updates the known-bad mappings with the results of a batch. Results are processed in case ID order,
+// and failures are minimized one at a time, so that the same mappings are found regardless of the order the batch finished in.
+func (s *PruningScheduler) Record(results []CaseResult) {
+	sorted := s.Project.sortedResults(results)
+	if s.Minimizer != nil {
+		for _, result := range sorted {
+			if result.Status != CaseStatusSkipped {
+				s.Minimizer.Known[s.Project.CaseID(result.Case)] = s.Project.FailureSignature(result.Case, result.Err)
+			}
+		}
+	}
+	switch s.Mode {
+	case PruneChoices:
+		for _, result := range sorted {
+			if !result.Status.Failed() {
+				continue
+			}
+			for _, name := range s.Project.VariableOrder {
+				if choice, ok := result.Case[name]; ok {
+					s.KnownBad.Add(Case{name: choice})
+				}
+			}
+		}
+	case PruneCulprits:
+		for _, group := range s.Project.GroupFailures(sorted) {
+			if _, ok := s.KnownBad.Match(group.Cases[0]); ok {
+				continue
+			}
+			s.KnownBad.Add(s.Minimizer.Minimize(group.Cases[0], group.Signature).Mappings)
+		}
+	}
+}
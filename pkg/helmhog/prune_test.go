@@ -0,0 +1,247 @@
+package helmhog
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// pruneTestOutcome fails cases with a=bad for one reason, and cases with b=b2 and c=c2 for another
+func pruneTestOutcome(c Case) error {
+	if c["a"] == "bad" {
+		return errors.New("A")
+	}
+	if c["b"] == "b2" && c["c"] == "c2" {
+		return errors.New("BC")
+	}
+	return nil
+}
+
+func TestPruningOrder(t *testing.T) {
+	l := loadTestProject(t, minimizeTestProject)
+	all := collectCases(l.generateExhaustive)
+	s := PruningScheduler{Project: l, Mode: PruneChoices, BatchSize: 4, KnownBad: NewKnownBad(l)}
+	ordered := s.Order(all)
+
+	if len(ordered) != len(all) {
+		t.Fatalf("Ordered %d cases, want %d", len(ordered), len(all))
+	}
+	seen := make(map[string]struct{}, len(ordered))
+	for _, c := range ordered {
+		seen[l.CaseID(c)] = struct{}{}
+	}
+	for _, c := range all {
+		if _, ok := seen[l.CaseID(c)]; !ok {
+			t.Errorf("%s is missing from the order", l.CaseID(c))
+		}
+	}
+
+	// b has the most choices, so every choice is covered by the first 3 cases
+	for _, name := range l.VariableOrder {
+		for choice := range l.Variables[name] {
+			covered := false
+			for _, c := range ordered[:3] {
+				if c[name] == choice {
+					covered = true
+				}
+			}
+			if !covered {
+				t.Errorf("%s=%s is not covered by the first cases: %s", name, choice, caseIDs(l, ordered[:3]))
+			}
+		}
+	}
+
+	batches := s.Batches(ordered)
+	if len(batches) != (len(all)+3)/4 {
+		t.Errorf("Got %d batches, want %d", len(batches), (len(all)+3)/4)
+	}
+	batched := make([]Case, 0, len(ordered))
+	for ix, batch := range batches {
+		if len(batch) > 4 || (ix != len(batches)-1 && len(batch) != 4) {
+			t.Errorf("Batch %d has %d cases", ix, len(batch))
+		}
+		batched = append(batched, batch...)
+	}
+	if caseIDs(l, batched) != caseIDs(l, ordered) {
+		t.Errorf("Batches do not contain the ordered cases in order")
+	}
+}
+
+func TestPruningRecord(t *testing.T) {
+	l := loadTestProject(t, minimizeTestProject)
+	results := []CaseResult{
+		{Case: Case{"a": "ok", "b": "b2", "c": "c2", "d": "d1"}, Status: CaseStatusFailed, Err: errors.New("BC")},
+		{Case: Case{"a": "bad", "b": "b1", "c": "c1", "d": "d1"}, Status: CaseStatusFailed, Err: errors.New("A")},
+		{Case: Case{"a": "ok", "b": "b1", "c": "c1", "d": "d1"}, Status: CaseStatusPassed},
+		{Case: Case{"a": "ok", "b": "b3", "c": "c1", "d": "d2"}, Status: CaseStatusSkipped},
+	}
+	tests := []struct {
+		mode     PruneMode
+		knownBad []string
+		pruned   []Case
+		kept     []Case
+	}{
+		{
+			mode:     PruneNone,
+			knownBad: []string{},
+			kept:     []Case{{"a": "bad", "b": "b1", "c": "c1", "d": "d2"}},
+		},
+		{
+			mode:     PruneChoices,
+			knownBad: []string{"a=bad", "b=b1", "c=c1", "d=d1", "a=ok", "b=b2", "c=c2"},
+			// Every choice of c failed, so every case is pruned
+			pruned: []Case{{"a": "ok", "b": "b3", "c": "c1", "d": "d2"}, {"a": "bad", "b": "b3", "c": "c1", "d": "d2"}},
+		},
+		{
+			mode: PruneCulprits,
+			// Changing a to bad fails for a different reason, so a=ok is part of the culprit
+			knownBad: []string{"a=bad", "a=ok,b=b2,c=c2"},
+			pruned:   []Case{{"a": "bad", "b": "b3", "c": "c1", "d": "d2"}, {"a": "ok", "b": "b2", "c": "c2", "d": "d2"}},
+			kept:     []Case{{"a": "ok", "b": "b2", "c": "c1", "d": "d2"}, {"a": "ok", "b": "b3", "c": "c1", "d": "d1"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(string(test.mode), func(t *testing.T) {
+			s := PruningScheduler{
+				Project:   l,
+				Mode:      test.mode,
+				BatchSize: 4,
+				KnownBad:  NewKnownBad(l),
+				Minimizer: &Minimizer{
+					Project: l,
+					Run:     func(c Case) (string, bool) { return l.FailureSignature(c, pruneTestOutcome(c)), true },
+					Verify:  DefaultMinimizeVerify,
+					Known:   make(map[string]string),
+				},
+			}
+			s.Record(results)
+
+			knownBad := make([]string, 0, len(s.KnownBad.mappings))
+			for _, mappings := range s.KnownBad.mappings {
+				knownBad = append(knownBad, l.CaseID(mappings))
+			}
+			if strings.Join(knownBad, " ") != strings.Join(test.knownBad, " ") {
+				t.Errorf("Known-bad mappings are %v, want %v", knownBad, test.knownBad)
+			}
+			for _, c := range test.pruned {
+				if _, ok := s.Prune(c); !ok {
+					t.Errorf("%s was not pruned", l.CaseID(c))
+				}
+			}
+			for _, c := range test.kept {
+				if mappings, ok := s.Prune(c); ok {
+					t.Errorf("%s was pruned by %s", l.CaseID(c), l.CaseID(mappings))
+				}
+			}
+			// Skipped cases were never run, so their signatures are not known
+			if _, ok := s.Minimizer.Known[l.CaseID(results[3].Case)]; ok {
+				t.Errorf("Skipped case was recorded as known")
+			}
+		})
+	}
+}
+
+// simulatePruning runs every case of a project in batches the way the test command does, with a number of workers
+// which finish their cases in a random order, and returns how each case was handled, followed by the known-bad mappings
+func simulatePruning(t *testing.T, l *LoadedProject, mode PruneMode, parallel int, seed int64) string {
+	rng := rand.New(rand.NewSource(seed))
+	runs := make(map[string]int)
+	minimized := make(map[string]error)
+	minimizer := Minimizer{
+		Project: l,
+		Run: func(c Case) (string, bool) {
+			runs[l.CaseID(c)]++
+			err := pruneTestOutcome(c)
+			minimized[l.CaseID(c)] = err
+			return l.FailureSignature(c, err), true
+		},
+		Verify: DefaultMinimizeVerify,
+		Known:  make(map[string]string),
+	}
+	s := PruningScheduler{Project: l, Mode: mode, BatchSize: 3, KnownBad: NewKnownBad(l), Minimizer: &minimizer}
+
+	toResult := func(c Case, err error) CaseResult {
+		if err != nil {
+			return CaseResult{Case: c, Status: CaseStatusFailed, Err: err}
+		}
+		return CaseResult{Case: c, Status: CaseStatusPassed}
+	}
+	handled := make(map[string]string)
+	for _, batch := range s.Batches(s.Order(collectCases(l.generateExhaustive))) {
+		batchResults := make([]CaseResult, 0, len(batch))
+		toRun := make([]Case, 0, len(batch))
+		for _, c := range batch {
+			id := l.CaseID(c)
+			if err, ok := minimized[id]; ok {
+				handled[id] = "minimized"
+				batchResults = append(batchResults, toResult(c, err))
+				continue
+			}
+			if _, ok := s.Prune(c); ok {
+				handled[id] = "pruned"
+				continue
+			}
+			toRun = append(toRun, c)
+		}
+		// Each worker finishes its cases in a random order, and the workers race each other
+		work := make(chan Case)
+		workResults := make(chan CaseResult)
+		for i := 0; i < parallel; i++ {
+			go func() {
+				for c := range work {
+					workResults <- toResult(c, pruneTestOutcome(c))
+				}
+			}()
+		}
+		go func() {
+			defer close(work)
+			for _, ix := range rng.Perm(len(toRun)) {
+				work <- toRun[ix]
+			}
+		}()
+		for range toRun {
+			result := <-workResults
+			runs[l.CaseID(result.Case)]++
+			handled[l.CaseID(result.Case)] = "ran"
+			batchResults = append(batchResults, result)
+		}
+		s.Record(batchResults)
+	}
+
+	for id, count := range runs {
+		if count > 1 {
+			t.Errorf("Ran %s %d times", id, count)
+		}
+	}
+	var outcome strings.Builder
+	for _, c := range collectCases(l.generateExhaustive) {
+		fmt.Fprintf(&outcome, "%s: %s\n", l.CaseID(c), handled[l.CaseID(c)])
+	}
+	for _, mappings := range s.KnownBad.mappings {
+		fmt.Fprintf(&outcome, "known bad: %s\n", l.CaseID(mappings))
+	}
+	return outcome.String()
+}
+
+func TestPruningIgnoresParallelism(t *testing.T) {
+	l := loadTestProject(t, minimizeTestProject)
+	for _, mode := range []PruneMode{PruneChoices, PruneCulprits} {
+		t.Run(string(mode), func(t *testing.T) {
+			want := simulatePruning(t, l, mode, 1, 1)
+			// Minimizing runs most of the cases in a project this small, so they are reported instead of being pruned
+			if !strings.Contains(want, ": pruned\n") && !strings.Contains(want, ": minimized\n") {
+				t.Errorf("Every case was run:\n%s", want)
+			}
+			for _, parallel := range []int{1, 4, 8} {
+				for seed := int64(1); seed <= 5; seed++ {
+					got := simulatePruning(t, l, mode, parallel, seed)
+					if got != want {
+						t.Errorf("Pruning with %d workers and seed %d differs from 1 worker.\ngot:\n%s\nwant:\n%s", parallel, seed, got, want)
+					}
+				}
+			}
+		})
+	}
+}
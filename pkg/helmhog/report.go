@@ -0,0 +1,301 @@
+package helmhog
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/meln5674/gosh"
+	"github.com/pkg/errors"
+)
+
+type CaseStatus string
+
+const (
+	// StageTemplate renders a case
+	StageTemplate = "template"
+	// StageExpectedFailure renders a case which is expected to fail and checks its error output
+	StageExpectedFailure = "expected-failure"
+	// StageInstall installs a case, runs its tests, and removes it
+	StageInstall = "install"
+	// StageSnapshot compares the rendered manifests of a case to its snapshot
+	StageSnapshot = "snapshot"
+)
+
+const (
+	CaseStatusPassed  CaseStatus = "passed"
+	CaseStatusFailed  CaseStatus = "failed"
+	CaseStatusSkipped CaseStatus = "skipped"
+	// CaseStatusExpectedFailure is a case which passed because it failed as expected by an ExpectedFailure
+	CaseStatusExpectedFailure CaseStatus = "expected-failure"
+	// CaseStatusTimedOut is a case which failed because it did not finish within its timeout
+	CaseStatusTimedOut CaseStatus = "timed-out"
+)
+
+// Failed returns true if a case with this status failed, including if it timed out
+func (s CaseStatus) Failed() bool {
+	return s == CaseStatusFailed || s == CaseStatusTimedOut
+}
+
+// A CaseTimeoutError is the error of a case which did not finish within its timeout
+type CaseTimeoutError struct {
+	Timeout time.Duration
+}
+
+func (e *CaseTimeoutError) Error() string {
+	return fmt.Sprintf("Case did not finish within %s", e.Timeout)
+}
+
+// IsCaseTimeout returns true if an error is, or wraps, a CaseTimeoutError
+func IsCaseTimeout(err error) bool {
+	var timeoutErr *CaseTimeoutError
+	return errors.As(err, &timeoutErr)
+}
+
+// A CaseResult is the outcome of testing a single case
+type CaseResult struct {
+	Case     Case
+	Status   CaseStatus
+	Err      error
+	Duration time.Duration
+	Stages   []StageResult
+}
+
+// A StageResult is the outcome of a single stage of testing a case, e.g. rendering it, or running one of the validators
+type StageResult struct {
+	Name string
+	// ExitStatus is the exit code of the stage's command, if it ran one, otherwise 1 if it failed and 0 if it passed
+	ExitStatus int
+	Duration   time.Duration
+	Err        error
+}
+
+// exitStatus returns the exit code of the first failed process in an error, or 1 if the error did not come
+// from a process exiting
+func exitStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 {
+		return exitErr.ExitCode()
+	}
+	var multiErr *gosh.MultiProcessError
+	if errors.As(err, &multiErr) {
+		for _, err := range multiErr.Errors {
+			if status := exitStatus(err); status != 0 {
+				return status
+			}
+		}
+	}
+	return 1
+}
+
+// Stages records the results of the stages of a case. Stages may be recorded concurrently.
+// A nil *Stages runs stages without recording them.
+type Stages struct {
+	lock    sync.Mutex
+	results []StageResult
+}
+
+// Run runs a stage and records its result
+func (s *Stages) Run(name string, f func() error) error {
+	start := time.Now()
+	err := f()
+	if s == nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.results = append(s.results, StageResult{Name: name, ExitStatus: exitStatus(err), Duration: time.Since(start), Err: err})
+	return err
+}
+
+// Command wraps a command so that its result is recorded as a stage when it is run. The command is run with RunContext,
+// so that killing the wrapper stops it even if it is a sequence.
+func (s *Stages) Command(name string, cmd gosh.Commander) gosh.Commander {
+	return funcCommand(func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+		return s.Run(name, func() error { return RunContext(ctx, cmd) })
+	})
+}
+
+// Results returns the results of every stage recorded so far, in the order they finished
+func (s *Stages) Results() []StageResult {
+	if s == nil {
+		return nil
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	results := make([]StageResult, len(s.results))
+	copy(results, s.results)
+	return results
+}
+
+// sortedResults returns a copy of a set of results, sorted by case ID, so that reports do not depend on the order
+// in which cases finished
+func (l *LoadedProject) sortedResults(results []CaseResult) []CaseResult {
+	sorted := make([]CaseResult, len(results))
+	copy(sorted, results)
+	sort.SliceStable(sorted, func(i, j int) bool { return l.CaseID(sorted[i].Case) < l.CaseID(sorted[j].Case) })
+	return sorted
+}
+
+// CaseErrorOutput returns the contents of every non-empty error output file of a case, e.g. lint.err and template.err,
+// each preceded by a header with its file name
+func (l *LoadedProject) CaseErrorOutput(c Case) string {
+	var output strings.Builder
+	for _, path := range l.AllTempPaths(c) {
+		if filepath.Ext(path) != ".err" {
+			continue
+		}
+		contents, err := os.ReadFile(path)
+		if err != nil || len(strings.TrimSpace(string(contents))) == 0 {
+			continue
+		}
+		output.WriteString("==> ")
+		output.WriteString(filepath.Base(path))
+		output.WriteString(" <==\n")
+		output.Write(contents)
+		if !strings.HasSuffix(string(contents), "\n") {
+			output.WriteString("\n")
+		}
+	}
+	return output.String()
+}
+
+// CaseArtifacts returns the paths of the files and directories written for a case which still exist,
+// keyed by their names
+func (l *LoadedProject) CaseArtifacts(c Case) map[string]string {
+	artifacts := make(map[string]string)
+	for _, path := range l.AllTempPaths(c) {
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		artifacts[filepath.Base(path)] = path
+	}
+	return artifacts
+}
+
+// reportArtifactsSuffix is appended to the name of a report, without its extension, to name its artifacts directory
+const reportArtifactsSuffix = "-artifacts"
+
+// ReportArtifactsDir returns the directory next to a report which the files written for the cases it refers to are copied into,
+// e.g. helm-hog-artifacts for helm-hog.xml. They are copied because the temporary directory they are written to is removed
+// once the run finishes, unless --keep-reports is set.
+func ReportArtifactsDir(reportPath string) string {
+	return strings.TrimSuffix(reportPath, filepath.Ext(reportPath)) + reportArtifactsSuffix
+}
+
+// copyPath copies a file, or a directory and everything in it, from src to dst
+func copyPath(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if entry.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, contents, 0644)
+	})
+}
+
+// copyReportArtifacts copies the files and directories written for a case which still exist into a directory named by
+// its hash in the artifacts directory of a report at reportPath. It returns that directory, and the path of each copy,
+// keyed by its name, both relative to the directory containing the report. If nothing was written for the case,
+// e.g. because it was skipped, no directory is created, and an empty path is returned.
+func (l *LoadedProject) copyReportArtifacts(reportPath string, c Case) (string, map[string]string, error) {
+	artifacts := make(map[string]string)
+	caseArtifacts := l.CaseArtifacts(c)
+	if len(caseArtifacts) == 0 {
+		return "", artifacts, nil
+	}
+	artifactsDir := ReportArtifactsDir(reportPath)
+	dir := filepath.Join(artifactsDir, l.CaseHash(c))
+	relDir := filepath.Join(filepath.Base(artifactsDir), l.CaseHash(c))
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return "", nil, err
+	}
+	for name, path := range caseArtifacts {
+		err = copyPath(path, filepath.Join(dir, name))
+		if err != nil {
+			return "", nil, errors.Wrap(err, fmt.Sprintf("copy %s", path))
+		}
+		artifacts[name] = filepath.Join(relDir, name)
+	}
+	return relDir, artifacts, nil
+}
+
+// A ChoiceSummary counts the results of the cases which used a choice
+type ChoiceSummary struct {
+	Passed int `json:"passed"`
+	// Failed includes cases which timed out
+	Failed          int `json:"failed"`
+	Skipped         int `json:"skipped"`
+	ExpectedFailure int `json:"expectedFailure"`
+}
+
+func (s *ChoiceSummary) count(status CaseStatus) {
+	switch status {
+	case CaseStatusPassed:
+		s.Passed++
+	case CaseStatusFailed, CaseStatusTimedOut:
+		s.Failed++
+	case CaseStatusSkipped:
+		s.Skipped++
+	case CaseStatusExpectedFailure:
+		s.ExpectedFailure++
+	}
+}
+
+// Summarize counts the results of the cases which used each choice of each variable
+func (l *LoadedProject) Summarize(results []CaseResult) map[VariableName]map[ChoiceName]*ChoiceSummary {
+	summary := make(map[VariableName]map[ChoiceName]*ChoiceSummary, len(l.Variables))
+	for variable, choices := range l.Variables {
+		summary[variable] = make(map[ChoiceName]*ChoiceSummary, len(choices))
+		for choice := range choices {
+			summary[variable][choice] = new(ChoiceSummary)
+		}
+	}
+	for _, result := range results {
+		for variable, choice := range result.Case {
+			choiceSummary, ok := summary[variable][choice]
+			if !ok {
+				continue
+			}
+			choiceSummary.count(result.Status)
+		}
+	}
+	return summary
+}
+
+// FailedChoices returns the choices of each variable which were used by at least one failed case, in sorted order
+func FailedChoices(summary map[VariableName]map[ChoiceName]*ChoiceSummary) map[VariableName][]ChoiceName {
+	failed := make(map[VariableName][]ChoiceName, len(summary))
+	for variable, choices := range summary {
+		failed[variable] = make([]ChoiceName, 0)
+		for choice, choiceSummary := range choices {
+			if choiceSummary.Failed != 0 {
+				failed[variable] = append(failed[variable], choice)
+			}
+		}
+		sort.Strings(failed[variable])
+	}
+	return failed
+}
@@ -0,0 +1,180 @@
+package helmhog
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+var updateGolden = flag.Bool("update-golden", false, "If set, overwrite the golden files in testdata/reports with the reports written by the tests")
+
+// reportTestStart is the start of the run in reportTestResults
+var reportTestStart = time.Date(2023, 7, 1, 12, 30, 0, 0, time.UTC)
+
+// reportTestResults returns a result with each status, writing the files each case would have written
+func reportTestResults(t *testing.T, l *LoadedProject) []CaseResult {
+	t.Helper()
+	results := []CaseResult{
+		{
+			Case:     Case{"db": "postgres", "ingress": "nginx"},
+			Status:   CaseStatusPassed,
+			Duration: 1500 * time.Millisecond,
+			Stages: []StageResult{
+				{Name: StageTemplate, Duration: 500 * time.Millisecond},
+				{Name: ValidatorLint, Duration: time.Second},
+			},
+		},
+		{
+			Case:     Case{"db": "none", "ingress": "nginx"},
+			Status:   CaseStatusFailed,
+			Err:      errors.New("exit status 1"),
+			Duration: 250 * time.Millisecond,
+			Stages: []StageResult{
+				{Name: StageTemplate, ExitStatus: 1, Duration: 250 * time.Millisecond, Err: errors.New("exit status 1")},
+			},
+		},
+		{
+			Case:     Case{"db": "mysql", "ingress": "none"},
+			Status:   CaseStatusTimedOut,
+			Err:      &CaseTimeoutError{Timeout: time.Minute},
+			Duration: time.Minute,
+			Stages: []StageResult{
+				{Name: StageTemplate, Duration: 100 * time.Millisecond},
+				{Name: ValidatorApply, ExitStatus: 1, Duration: time.Minute, Err: context.DeadlineExceeded},
+			},
+		},
+		{
+			Case:     Case{"db": "none", "ingress": "none"},
+			Status:   CaseStatusExpectedFailure,
+			Duration: 200 * time.Millisecond,
+			Stages: []StageResult{
+				{Name: StageExpectedFailure, Duration: 200 * time.Millisecond},
+			},
+		},
+		{
+			Case:   Case{"db": "mysql", "ingress": "nginx"},
+			Status: CaseStatusSkipped,
+		},
+	}
+	files := map[string]string{
+		l.TemplateOutPath(results[0].Case): "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: demo\n",
+		l.LintOutPath(results[0].Case):     "1 chart(s) linted, 0 chart(s) failed\n",
+		l.TemplateErrPath(results[1].Case): "Error: template: demo/templates/configmap.yaml:8:41: executing \"demo/templates/configmap.yaml\" at <.Values.db.host>: nil pointer evaluating interface {}.host\n",
+		l.TemplateOutPath(results[2].Case): "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: demo\n",
+		l.ApplyErrPath(results[2].Case):    "error: timed out waiting for the condition\n",
+		l.TemplateErrPath(results[3].Case): "Error: a database is required\n",
+	}
+	for _, result := range results[:4] {
+		err := l.MakeCaseTempDir(result.Case)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for path, contents := range files {
+		err := os.WriteFile(path, []byte(contents), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return results
+}
+
+// checkGolden compares a report to a golden file in testdata/reports, or overwrites the golden file if -update-golden is set
+func checkGolden(t *testing.T, name string, report []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", "reports", name)
+	if *updateGolden {
+		err := os.WriteFile(path, report, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	golden, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(report) != string(golden) {
+		t.Errorf("Report does not match %s, run go test with -update-golden if this is expected. Got:\n%s", path, report)
+	}
+}
+
+func TestReportArtifactsDir(t *testing.T) {
+	tests := map[string]string{
+		"helm-hog.xml":           "helm-hog-artifacts",
+		"reports/helm-hog.json":  "reports/helm-hog-artifacts",
+		"/tmp/report":            "/tmp/report-artifacts",
+		"reports/run.1.html":     "reports/run.1-artifacts",
+		"./reports/results.html": "./reports/results-artifacts",
+	}
+	for reportPath, want := range tests {
+		if dir := ReportArtifactsDir(reportPath); dir != want {
+			t.Errorf("ReportArtifactsDir(%s) = %s, want %s", reportPath, dir, want)
+		}
+	}
+}
+
+func TestCopyReportArtifacts(t *testing.T) {
+	l := loadTestProject(t, selectorTestProject)
+	results := reportTestResults(t, l)
+	c := results[0].Case
+	err := os.MkdirAll(l.PodLogsDir(c), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(l.PodLogsDir(c), "demo.log"), []byte("started\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reportPath := filepath.Join(t.TempDir(), "report.xml")
+	dir, artifacts, err := l.copyReportArtifacts(reportPath, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dir != filepath.Join("report-artifacts", l.CaseHash(c)) {
+		t.Errorf("Artifacts were copied to %s", dir)
+	}
+	names := make([]string, 0, len(artifacts))
+	for name, path := range artifacts {
+		names = append(names, name)
+		if path != filepath.Join(dir, name) {
+			t.Errorf("Artifact %s was copied to %s", name, path)
+		}
+	}
+	sort.Strings(names)
+	if strings.Join(names, " ") != "case.id lint.out logs template.out" {
+		t.Errorf("Copied artifacts %v", names)
+	}
+
+	// The copies outlive the temporary directory
+	err = l.RemoveTempDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"template.out":  "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: demo\n",
+		"logs/demo.log": "started\n",
+		"case.id":       "db=postgres,ingress=nginx\n",
+		"lint.out":      "1 chart(s) linted, 0 chart(s) failed\n",
+	} {
+		contents, err := os.ReadFile(filepath.Join(filepath.Dir(reportPath), dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(contents) != want {
+			t.Errorf("Copy of %s contains %q, want %q", name, contents, want)
+		}
+	}
+
+	dir, artifacts, err = l.copyReportArtifacts(reportPath, results[4].Case)
+	if err != nil || dir != "" || len(artifacts) != 0 {
+		t.Errorf("copyReportArtifacts() = %s, %v, %v for a skipped case", dir, artifacts, err)
+	}
+}
@@ -1,33 +1,103 @@
 package helmhog
 
+import (
+	"fmt"
+	"sort"
+)
+
 type RuleName string
 
 type Requirement struct {
-	If   MappingSet `json:"if"`
-	Then MappingSet `json:"then"`
+	If   Condition `json:"if"`
+	Then Condition `json:"then"`
 }
 
 func (r *Requirement) Allows(c Case) bool {
-	for k, v := range r.If {
-		if c[k] != v {
-			return true
-		}
-	}
-	for k, v := range r.Then {
-		if c[k] != v {
-			return false
-		}
-	}
-	return true
+	return !r.If.Matches(c) || r.Then.Matches(c)
+}
+
+func (r *Requirement) Variables() []VariableName {
+	return append(r.If.Variables(), r.Then.Variables()...)
+}
+
+type Restriction struct {
+	Condition
+}
+
+func (r *Restriction) Allows(c Case) bool {
+	return !r.Matches(c)
+}
+
+// A Rule decides which cases are allowed
+type Rule interface {
+	Allows(Case) bool
+	// Variables returns the names of every variable the rule refers to
+	Variables() []VariableName
+}
+
+var (
+	_ = Rule(&Requirement{})
+	_ = Rule(&Restriction{})
+	_ = Rule(&Expression{})
+)
+
+type RuleKind string
+
+const (
+	RuleKindRequirement RuleKind = "Requirement"
+	RuleKindRestriction RuleKind = "Restriction"
+	RuleKindCondition   RuleKind = "Condition"
+)
+
+// A NamedRule is a rule of a project, along with its kind and name
+type NamedRule struct {
+	Rule
+	Kind RuleKind
+	Name RuleName
 }
 
-type Restriction MappingSet
+func (r NamedRule) String() string {
+	return fmt.Sprintf("%s %s", r.Kind, r.Name)
+}
 
-func (r Restriction) Allows(c Case) bool {
-	for k, v := range r {
-		if c[k] != v {
-			return true
+// Rules returns every requirement, restriction, and condition of the project, in that order, each sorted by name
+func (l *LoadedProject) Rules() []NamedRule {
+	rules := make([]NamedRule, 0, len(l.Requirements)+len(l.Restrictions)+len(l.Conditions))
+	sorted := func(add func()) {
+		start := len(rules)
+		add()
+		sort.Slice(rules[start:], func(i, j int) bool { return rules[start+i].Name < rules[start+j].Name })
+	}
+	sorted(func() {
+		for name := range l.Requirements {
+			rule := l.Requirements[name]
+			rules = append(rules, NamedRule{Rule: &rule, Kind: RuleKindRequirement, Name: name})
+		}
+	})
+	sorted(func() {
+		for name := range l.Restrictions {
+			rule := l.Restrictions[name]
+			rules = append(rules, NamedRule{Rule: &rule, Kind: RuleKindRestriction, Name: name})
 		}
+	})
+	sorted(func() {
+		for name, rule := range l.Conditions {
+			rules = append(rules, NamedRule{Rule: rule, Kind: RuleKindCondition, Name: name})
+		}
+	})
+	return rules
+}
+
+// Definition returns a human-readable representation of what the rule matches
+func (r NamedRule) Definition() string {
+	switch rule := r.Rule.(type) {
+	case *Requirement:
+		return fmt.Sprintf("if %s then %s", rule.If, rule.Then)
+	case *Restriction:
+		return rule.Condition.String()
+	case *Expression:
+		return rule.Source
+	default:
+		return fmt.Sprintf("%v", rule)
 	}
-	return false
 }
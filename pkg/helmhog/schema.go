@@ -0,0 +1,330 @@
+package helmhog
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/xeipuuv/gojsonschema"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// DefaultKubernetesVersion is the version of the schemas used by ApplyModeSchema if none is specified
+	DefaultKubernetesVersion = "master"
+
+	// schemaDirStrictSuffix and schemaDirSuffix are the suffixes of the directories containing the schemas for a kubernetes version,
+	// in order of preference. These match the layout used by kubeconform and kubernetes-json-schema.
+	schemaDirStrictSuffix = "-standalone-strict"
+	schemaDirSuffix       = "-standalone"
+
+	crdKind = "CustomResourceDefinition"
+
+	// openAPINullable and openAPIIntOrString are the OpenAPI extensions used by CRD schemas which JSON schema does not have
+	openAPINullable    = "nullable"
+	openAPIIntOrString = "x-kubernetes-int-or-string"
+)
+
+// schemaState holds the schemas used by ApplyModeSchema. Schemas from the schema directory are loaded as they are
+// needed and shared by every case.
+type schemaState struct {
+	lock    sync.Mutex
+	crds    map[schema.GroupVersionKind]*gojsonschema.Schema
+	schemas map[schema.GroupVersionKind]*gojsonschema.Schema
+}
+
+// schemaObject is the subset of an object needed to find its schema, select it, and describe it
+type schemaObject struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		Name      string            `json:"name"`
+		Namespace string            `json:"namespace"`
+		Labels    map[string]string `json:"labels"`
+	} `json:"metadata"`
+}
+
+func (o *schemaObject) String() string {
+	if o.Metadata.Namespace != "" {
+		return fmt.Sprintf("%s %s/%s (%s)", o.Kind, o.Metadata.Namespace, o.Metadata.Name, o.APIVersion)
+	}
+	return fmt.Sprintf("%s %s (%s)", o.Kind, o.Metadata.Name, o.APIVersion)
+}
+
+// readDocuments reads every non-empty document from a multi-document YAML stream, converted to JSON
+func readDocuments(r io.Reader) ([][]byte, error) {
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(r))
+	docs := make([][]byte, 0)
+	for {
+		doc, err := reader.Read()
+		if err == io.EOF {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		docJSON, err := yaml.YAMLToJSON(doc)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("parse document %d", len(docs)))
+		}
+		// Documents which are empty or only contain comments
+		if string(docJSON) == "null" {
+			continue
+		}
+		docs = append(docs, docJSON)
+	}
+}
+
+// crdFiles returns the paths to every YAML or JSON file in a CRD path, which is either a file or a directory.
+// Directories are not recursively searched.
+func crdFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("list directory %s", path))
+	}
+	files := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		switch filepath.Ext(entry.Name()) {
+		case ".yaml", ".yml", ".json":
+			files = append(files, filepath.Join(path, entry.Name()))
+		}
+	}
+	return files, nil
+}
+
+// translateOpenAPI converts the OpenAPI extensions in a CRD schema, and every schema nested in it, into JSON schema,
+// so that null is allowed for nullable fields, and both integers and strings are allowed for int-or-string fields
+func translateOpenAPI(s interface{}) {
+	switch s := s.(type) {
+	case []interface{}:
+		for _, item := range s {
+			translateOpenAPI(item)
+		}
+	case map[string]interface{}:
+		for key, value := range s {
+			switch key {
+			// These are values, not schemas
+			case "default", "example", "enum":
+				continue
+			}
+			translateOpenAPI(value)
+		}
+		if intOrString, _ := s[openAPIIntOrString].(bool); intOrString {
+			delete(s, "type")
+			if _, ok := s["anyOf"]; !ok {
+				s["anyOf"] = []interface{}{
+					map[string]interface{}{"type": "integer"},
+					map[string]interface{}{"type": "string"},
+				}
+			}
+		}
+		if nullable, _ := s[openAPINullable].(bool); nullable {
+			if t, ok := s["type"].(string); ok {
+				s["type"] = []interface{}{t, "null"}
+			} else if anyOf, ok := s["anyOf"].([]interface{}); ok {
+				s["anyOf"] = append(anyOf, map[string]interface{}{"type": "null"})
+			}
+		}
+	}
+}
+
+// loadCRDs compiles the schemas of every version of every CustomResourceDefinition in the project's CRD paths
+func (l *LoadedProject) loadCRDs() error {
+	l.schema.crds = make(map[schema.GroupVersionKind]*gojsonschema.Schema)
+	l.schema.schemas = make(map[schema.GroupVersionKind]*gojsonschema.Schema)
+	for _, path := range l.CRDs {
+		files, err := crdFiles(path)
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("find CRDs in %s", path))
+		}
+		for _, file := range files {
+			err = l.loadCRDFile(file)
+			if err != nil {
+				return errors.Wrap(err, fmt.Sprintf("load CRDs from %s", file))
+			}
+		}
+	}
+	return nil
+}
+
+func (l *LoadedProject) loadCRDFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	docs, err := readDocuments(f)
+	if err != nil {
+		return err
+	}
+	for ix, doc := range docs {
+		var obj schemaObject
+		err = yaml.Unmarshal(doc, &obj)
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("parse document %d", ix))
+		}
+		if obj.Kind != crdKind {
+			continue
+		}
+		var crd apiextensionsv1.CustomResourceDefinition
+		err = yaml.Unmarshal(doc, &crd)
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("parse %s %s", crdKind, obj.Metadata.Name))
+		}
+		for _, version := range crd.Spec.Versions {
+			if version.Schema == nil || version.Schema.OpenAPIV3Schema == nil {
+				continue
+			}
+			gvk := schema.GroupVersionKind{Group: crd.Spec.Group, Version: version.Name, Kind: crd.Spec.Names.Kind}
+			schemaBytes, err := yaml.Marshal(version.Schema.OpenAPIV3Schema)
+			if err != nil {
+				return err
+			}
+			var openAPISchema interface{}
+			err = yaml.Unmarshal(schemaBytes, &openAPISchema)
+			if err != nil {
+				return err
+			}
+			translateOpenAPI(openAPISchema)
+			compiled, err := gojsonschema.NewSchema(gojsonschema.NewGoLoader(openAPISchema))
+			if err != nil {
+				return errors.Wrap(err, fmt.Sprintf("compile schema for %s", gvk))
+			}
+			l.schema.crds[gvk] = compiled
+		}
+	}
+	return nil
+}
+
+// SchemaPaths returns the paths in the schema directory which are checked, in order, for the schema of a kind
+func (l *LoadedProject) SchemaPaths(gvk schema.GroupVersionKind) []string {
+	version := l.Settings.KubernetesVersion
+	if version != DefaultKubernetesVersion && !strings.HasPrefix(version, "v") {
+		version = "v" + version
+	}
+	filename := strings.ToLower(gvk.Kind)
+	if gvk.Group != "" {
+		filename += "-" + strings.ToLower(strings.Split(gvk.Group, ".")[0])
+	}
+	filename += "-" + strings.ToLower(gvk.Version) + ".json"
+	return []string{
+		filepath.Join(l.Settings.SchemaDir, version+schemaDirStrictSuffix, filename),
+		filepath.Join(l.Settings.SchemaDir, version+schemaDirSuffix, filename),
+	}
+}
+
+// findSchema returns the schema for a kind, first from the project's CRDs, then from the schema directory,
+// or nil if there is no schema for it
+func (l *LoadedProject) findSchema(gvk schema.GroupVersionKind) (*gojsonschema.Schema, error) {
+	if compiled, ok := l.schema.crds[gvk]; ok {
+		return compiled, nil
+	}
+	l.schema.lock.Lock()
+	defer l.schema.lock.Unlock()
+	if compiled, ok := l.schema.schemas[gvk]; ok {
+		return compiled, nil
+	}
+	var compiled *gojsonschema.Schema
+	for _, path := range l.SchemaPaths(gvk) {
+		schemaBytes, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("read file %s", path))
+		}
+		compiled, err = gojsonschema.NewSchema(gojsonschema.NewBytesLoader(schemaBytes))
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("compile schema %s", path))
+		}
+		break
+	}
+	l.schema.schemas[gvk] = compiled
+	return compiled, nil
+}
+
+// validateSchemas validates every object in a stream of manifests against its schema, returning a finding for each
+// problem, and writing the result for each object to stdout, and each finding to stderr
+func (l *LoadedProject) validateSchemas(manifests io.Reader, stdout, stderr io.Writer) ([]Finding, error) {
+	docs, err := readDocuments(manifests)
+	if err != nil {
+		return nil, errors.Wrap(err, "read manifests")
+	}
+	findings := make([]Finding, 0)
+	invalid := 0
+	for ix, doc := range docs {
+		objFindings, err := func() ([]Finding, error) {
+			var obj schemaObject
+			err := yaml.Unmarshal(doc, &obj)
+			if err != nil {
+				return nil, errors.Wrap(err, fmt.Sprintf("parse document %d", ix))
+			}
+			if obj.APIVersion == "" || obj.Kind == "" {
+				return []Finding{{Object: fmt.Sprintf("document %d", ix), Message: "missing apiVersion or kind"}}, nil
+			}
+			gv, err := schema.ParseGroupVersion(obj.APIVersion)
+			if err != nil {
+				return []Finding{{Object: obj.String(), Message: err.Error()}}, nil
+			}
+			compiled, err := l.findSchema(gv.WithKind(obj.Kind))
+			if err != nil {
+				return nil, errors.Wrap(err, obj.String())
+			}
+			if compiled == nil {
+				if l.Settings.IgnoreMissingSchemas {
+					fmt.Fprintf(stdout, "%s skipped, no schema found\n", &obj)
+					return nil, nil
+				}
+				return []Finding{{
+					Object:  obj.String(),
+					Message: fmt.Sprintf("no schema found in %s or the project's CRDs", strings.Join(l.SchemaPaths(gv.WithKind(obj.Kind)), " or ")),
+				}}, nil
+			}
+			result, err := compiled.Validate(gojsonschema.NewBytesLoader(doc))
+			if err != nil {
+				return nil, errors.Wrap(err, obj.String())
+			}
+			objFindings := make([]Finding, 0, len(result.Errors()))
+			for _, resultErr := range result.Errors() {
+				objFindings = append(objFindings, Finding{Object: obj.String(), Message: resultErr.String()})
+			}
+			if len(objFindings) == 0 {
+				fmt.Fprintf(stdout, "%s valid\n", &obj)
+			}
+			return objFindings, nil
+		}()
+		if err != nil {
+			return findings, err
+		}
+		if len(objFindings) != 0 {
+			invalid++
+		}
+		for _, finding := range objFindings {
+			finding.Validator = ValidatorApply
+			fmt.Fprintf(stderr, "%s: %s\n", finding.Object, finding.Message)
+			findings = append(findings, finding)
+		}
+	}
+	if invalid != 0 {
+		fmt.Fprintf(stderr, "%d of %d objects are invalid\n", invalid, len(docs))
+	}
+	return findings, nil
+}
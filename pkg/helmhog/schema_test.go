@@ -0,0 +1,242 @@
+package helmhog
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+// schemaTestProject uses the CRDs in testdata, and is validated against the schemas in testdata
+const schemaTestProject = snapshotTestProject + "crds: [testdata/crds]\n"
+
+func TestSchemaPaths(t *testing.T) {
+	tests := []struct {
+		version string
+		gvk     schema.GroupVersionKind
+		want    []string
+	}{
+		{
+			version: "1.27.3",
+			gvk:     schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"},
+			want:    []string{"schemas/v1.27.3-standalone-strict/configmap-v1.json", "schemas/v1.27.3-standalone/configmap-v1.json"},
+		},
+		{
+			version: "v1.27.3",
+			gvk:     schema.GroupVersionKind{Group: "networking.k8s.io", Version: "v1", Kind: "Ingress"},
+			want:    []string{"schemas/v1.27.3-standalone-strict/ingress-networking-v1.json", "schemas/v1.27.3-standalone/ingress-networking-v1.json"},
+		},
+		{
+			version: DefaultKubernetesVersion,
+			gvk:     schema.GroupVersionKind{Group: "autoscaling", Version: "v2", Kind: "HorizontalPodAutoscaler"},
+			want:    []string{"schemas/master-standalone-strict/horizontalpodautoscaler-autoscaling-v2.json", "schemas/master-standalone/horizontalpodautoscaler-autoscaling-v2.json"},
+		},
+	}
+	for _, test := range tests {
+		l := loadTestProjectWithSettings(t, schemaTestProject, ProjectSettings{ApplyMode: ApplyModeSchema, SchemaDir: "schemas", KubernetesVersion: test.version})
+		paths := l.SchemaPaths(test.gvk)
+		if strings.Join(paths, " ") != strings.Join(test.want, " ") {
+			t.Errorf("SchemaPaths(%s) = %v, want %v", test.gvk, paths, test.want)
+		}
+	}
+}
+
+func TestValidateSchemas(t *testing.T) {
+	tests := []struct {
+		name                 string
+		manifests            string
+		ignoreMissingSchemas bool
+		// findings are the messages of the findings, or empty if the manifests are valid
+		findings []string
+	}{
+		{
+			name: "strict schema is preferred",
+			manifests: `
+apiVersion: v1
+kind: ConfigMap
+metadata: {name: demo}
+data: {greeting: hello}
+unknown: field
+`,
+			findings: []string{"(root): Additional property unknown is not allowed"},
+		},
+		{
+			name: "non-strict schema is used if there is no strict schema",
+			manifests: `
+apiVersion: apps/v1
+kind: Deployment
+metadata: {name: demo}
+spec: {replicas: many, selector: {}, template: {}, unknown: field}
+`,
+			findings: []string{"spec.replicas: Invalid type. Expected: integer, given: string"},
+		},
+		{
+			name: "missing schema",
+			manifests: `
+apiVersion: v1
+kind: Service
+metadata: {name: demo}
+`,
+			findings: []string{"no schema found in testdata/schemas/v1.27.3-standalone-strict/service-v1.json or testdata/schemas/v1.27.3-standalone/service-v1.json or the project's CRDs"},
+		},
+		{
+			name: "ignored missing schema",
+			manifests: `
+apiVersion: v1
+kind: Service
+metadata: {name: demo}
+`,
+			ignoreMissingSchemas: true,
+		},
+		{
+			name: "missing kind",
+			manifests: `
+apiVersion: v1
+metadata: {name: demo}
+`,
+			findings: []string{"missing apiVersion or kind"},
+		},
+		{
+			name: "custom resources with OpenAPI extensions",
+			manifests: `
+apiVersion: example.com/v1
+kind: Widget
+metadata: {name: by-number}
+spec: {port: 80, targetPort: 8080, description: null, labels: null, replicas: 1}
+---
+apiVersion: example.com/v1
+kind: Widget
+metadata: {name: by-name}
+spec: {port: http, targetPort: null, description: a widget, labels: {app: demo}}
+`,
+		},
+		{
+			name: "invalid custom resources",
+			manifests: `
+apiVersion: example.com/v1
+kind: Widget
+metadata: {name: no-port}
+spec: {replicas: null}
+---
+apiVersion: example.com/v1
+kind: Widget
+metadata: {name: bad-port}
+spec: {port: true}
+`,
+			findings: []string{
+				"spec: port is required",
+				"spec.replicas: Invalid type. Expected: integer, given: null",
+				"spec.port: Must validate at least one schema (anyOf)",
+				"spec.port: Invalid type. Expected: integer, given: boolean",
+			},
+		},
+		{
+			name: "CRD version without a schema",
+			manifests: `
+apiVersion: example.com/v1alpha1
+kind: Widget
+metadata: {name: demo}
+`,
+			findings: []string{"no schema found in testdata/schemas/v1.27.3-standalone-strict/widget-example-v1alpha1.json or testdata/schemas/v1.27.3-standalone/widget-example-v1alpha1.json or the project's CRDs"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l := loadTestProjectWithSettings(t, schemaTestProject, ProjectSettings{
+				ApplyMode:            ApplyModeSchema,
+				SchemaDir:            "testdata/schemas",
+				KubernetesVersion:    "1.27.3",
+				IgnoreMissingSchemas: test.ignoreMissingSchemas,
+			})
+			var stdout, stderr bytes.Buffer
+			findings, err := l.validateSchemas(strings.NewReader(test.manifests), &stdout, &stderr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			messages := make([]string, 0, len(findings))
+			for _, finding := range findings {
+				if finding.Validator != ValidatorApply {
+					t.Errorf("Finding %s is not from the %s validator", finding, ValidatorApply)
+				}
+				messages = append(messages, finding.Message)
+			}
+			if strings.Join(messages, "\n") != strings.Join(test.findings, "\n") {
+				t.Errorf("Got findings:\n%s\nwant:\n%s", strings.Join(messages, "\n"), strings.Join(test.findings, "\n"))
+			}
+			if len(findings) != 0 && !strings.Contains(stderr.String(), "objects are invalid") {
+				t.Errorf("stderr does not summarize the invalid objects:\n%s", stderr.String())
+			}
+			if len(findings) == 0 && stderr.Len() != 0 {
+				t.Errorf("stderr is not empty for valid objects:\n%s", stderr.String())
+			}
+		})
+	}
+}
+
+func TestLoadCRDsErrors(t *testing.T) {
+	invalidCRD := filepath.Join(t.TempDir(), "invalid.yaml")
+	err := os.WriteFile(invalidCRD, []byte(`
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: gadgets.example.com
+spec:
+  group: example.com
+  names: {kind: Gadget, plural: gadgets}
+  versions:
+  - name: v1
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          size: {type: integer, minimum: small}
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		settings ProjectSettings
+		crds     string
+		err      string
+	}{
+		{
+			name:     "missing schema directory",
+			settings: ProjectSettings{ApplyMode: ApplyModeSchema},
+			crds:     "[]",
+			err:      "A schema directory is required",
+		},
+		{
+			name:     "missing CRD path",
+			settings: ProjectSettings{ApplyMode: ApplyModeSchema, IgnoreMissingSchemas: true},
+			crds:     "[testdata/missing]",
+			err:      "find CRDs in testdata/missing",
+		},
+		{
+			name:     "invalid CRD",
+			settings: ProjectSettings{ApplyMode: ApplyModeSchema, IgnoreMissingSchemas: true},
+			crds:     "[" + invalidCRD + "]",
+			err:      "load CRDs from " + invalidCRD,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := new(Project)
+			err := yaml.Unmarshal([]byte(snapshotTestProject+"crds: "+test.crds+"\n"), p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			l, err := p.Load(test.settings)
+			if err == nil {
+				l.RemoveTempDir()
+			}
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("expected error containing %q, got %v", test.err, err)
+			}
+		})
+	}
+}
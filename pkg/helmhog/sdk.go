@@ -0,0 +1,200 @@
+package helmhog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/meln5674/gosh"
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+)
+
+type Engine string
+
+const (
+	// EngineCLI renders and lints cases by running the helm binary
+	EngineCLI Engine = "cli"
+	// EngineSDK renders and lints cases in-process using the Helm Go libraries
+	EngineSDK Engine = "sdk"
+
+	DefaultEngine = EngineCLI
+
+	// releaseName and sdkNamespace match the defaults used by helm template
+	releaseName  = "release-name"
+	sdkNamespace = "default"
+)
+
+// sdkState holds the chart files and parsed parts, which are loaded once and shared by every case
+type sdkState struct {
+	once  sync.Once
+	err   error
+	files []*loader.BufferedFile
+	parts map[PartName]map[string]interface{}
+}
+
+func (l *LoadedProject) sdkLoad() error {
+	l.sdk.once.Do(func() {
+		chrt, err := loader.Load(l.Chart)
+		if err != nil {
+			l.sdk.err = errors.Wrap(err, fmt.Sprintf("load chart %s", l.Chart))
+			return
+		}
+		// The raw files are kept instead of the chart itself because rendering modifies the chart
+		l.sdk.files = make([]*loader.BufferedFile, 0, len(chrt.Raw))
+		for _, f := range chrt.Raw {
+			l.sdk.files = append(l.sdk.files, &loader.BufferedFile{Name: f.Name, Data: f.Data})
+		}
+
+		l.sdk.parts = make(map[PartName]map[string]interface{}, len(l.PartsMapping))
+		for name, path := range l.PartsMapping {
+			partBytes, err := os.ReadFile(path)
+			if err != nil {
+				l.sdk.err = errors.Wrap(err, fmt.Sprintf("read file %s", path))
+				return
+			}
+			part := make(map[string]interface{})
+			err = yaml.Unmarshal(partBytes, &part)
+			if err != nil {
+				l.sdk.err = errors.Wrap(err, fmt.Sprintf("parse part %s", name))
+				return
+			}
+			l.sdk.parts[name] = part
+		}
+	})
+	return l.sdk.err
+}
+
+// mergeValues merges override into base in the same way helm merges multiple values files.
+// Nested maps are always copied, as rendering modifies the values it is given, and parts are shared between cases.
+func mergeValues(base, override map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(base))
+	for k, v := range base {
+		out[k] = v
+	}
+	for k, v := range override {
+		if v, ok := v.(map[string]interface{}); ok {
+			baseV, _ := out[k].(map[string]interface{})
+			out[k] = mergeValues(baseV, v)
+			continue
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// sdkValues merges the parts of a case in the same order as ValuesArgs
+func (l *LoadedProject) sdkValues(c Case) map[string]interface{} {
+	vals := make(map[string]interface{})
+	for _, part := range l.CaseParts(c) {
+		vals = mergeValues(vals, l.sdk.parts[part])
+	}
+	return vals
+}
+
+// closeStream closes a stream provided to a gosh.Func, unless it is one of the standard streams of this process
+func closeStream(w io.Writer) {
+	if w == os.Stdout || w == os.Stderr {
+		return
+	}
+	if closer, ok := w.(io.Closer); ok {
+		closer.Close()
+	}
+}
+
+// funcCommand wraps a function as a gosh.Pipelineable which behaves like an external command,
+// closing its output streams when it finishes, and printing its error, if any
+func funcCommand(f func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error) *gosh.FuncCmd {
+	return gosh.FromFunc(context.Background(), func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer, done chan error) error {
+		go func() {
+			defer close(done)
+			defer closeStream(stdout)
+			defer closeStream(stderr)
+			err := f(ctx, stdin, stdout, stderr)
+			if err != nil {
+				fmt.Fprintf(stderr, "Error: %v\n", err)
+			}
+			done <- err
+		}()
+		return nil
+	})
+}
+
+// sdkLint lints a case like helm lint. Only the values come from sdkLoad, as every lint rule in the SDK takes the path
+// to the chart and reads it from disk itself, so unlike sdkTemplate, the chart is read again for each case.
+func (l *LoadedProject) sdkLint(c Case) *gosh.FuncCmd {
+	return funcCommand(func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+		err := l.sdkLoad()
+		if err != nil {
+			return err
+		}
+		result := action.NewLint().Run([]string{l.Chart}, l.sdkValues(c))
+
+		fmt.Fprintf(stdout, "==> Linting %s\n", l.Chart)
+		if len(result.Messages) == 0 {
+			for _, err := range result.Errors {
+				fmt.Fprintf(stdout, "Error %s\n", err)
+			}
+		}
+		for _, msg := range result.Messages {
+			fmt.Fprintf(stdout, "%s\n", msg)
+		}
+		fmt.Fprint(stdout, "\n")
+
+		failed := 0
+		if len(result.Errors) != 0 {
+			failed = 1
+		}
+		summary := fmt.Sprintf("1 chart(s) linted, %d chart(s) failed", failed)
+		if failed != 0 {
+			return errors.New(summary)
+		}
+		fmt.Fprintln(stdout, summary)
+		return nil
+	})
+}
+
+func (l *LoadedProject) sdkTemplate(c Case) *gosh.FuncCmd {
+	return funcCommand(func(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer) error {
+		err := l.sdkLoad()
+		if err != nil {
+			return err
+		}
+		chrt, err := loader.LoadFiles(l.sdk.files)
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("load chart %s", l.Chart))
+		}
+
+		client := action.NewInstall(&action.Configuration{Log: klog.V(4).Infof})
+		client.DryRun = true
+		client.ReleaseName = releaseName
+		client.Namespace = sdkNamespace
+		if namespace := l.renderNamespace(c); namespace != "" {
+			client.Namespace = namespace
+		}
+		client.Replace = true
+		client.ClientOnly = true
+		rel, err := client.RunWithContext(ctx, chrt, l.sdkValues(c))
+
+		// Like helm template --debug, print the manifests even if rendering failed
+		if rel != nil {
+			var manifests bytes.Buffer
+			fmt.Fprintln(&manifests, strings.TrimSpace(rel.Manifest))
+			for _, m := range rel.Hooks {
+				fmt.Fprintf(&manifests, "---\n# Source: %s\n%s\n", m.Path, m.Manifest)
+			}
+			_, writeErr := stdout.Write(manifests.Bytes())
+			if err == nil {
+				err = writeErr
+			}
+		}
+		return err
+	})
+}
@@ -0,0 +1,162 @@
+package helmhog
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"reflect"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+func TestMergeValues(t *testing.T) {
+	parse := func(s string) map[string]interface{} {
+		values := make(map[string]interface{})
+		err := yaml.Unmarshal([]byte(s), &values)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return values
+	}
+	tests := []struct {
+		name     string
+		base     string
+		override string
+		want     string
+	}{
+		{
+			name:     "empty base",
+			override: `{a: 1, nested: {b: 2}}`,
+			want:     `{a: 1, nested: {b: 2}}`,
+		},
+		{
+			name:     "scalars are overridden",
+			base:     `{a: 1, b: x}`,
+			override: `{a: 2, c: y}`,
+			want:     `{a: 2, b: x, c: y}`,
+		},
+		{
+			name:     "nested maps are merged",
+			base:     `{nested: {a: 1, deeper: {b: 2, c: 3}}}`,
+			override: `{nested: {deeper: {c: 4, d: 5}, e: 6}}`,
+			want:     `{nested: {a: 1, deeper: {b: 2, c: 4, d: 5}, e: 6}}`,
+		},
+		{
+			name:     "lists are replaced",
+			base:     `{list: [1, 2, 3]}`,
+			override: `{list: [4]}`,
+			want:     `{list: [4]}`,
+		},
+		{
+			name:     "maps replace scalars",
+			base:     `{a: 1}`,
+			override: `{a: {b: 2}}`,
+			want:     `{a: {b: 2}}`,
+		},
+		{
+			name:     "scalars replace maps",
+			base:     `{a: {b: 2}}`,
+			override: `{a: 1}`,
+			want:     `{a: 1}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			base := parse(test.base)
+			override := parse(test.override)
+			merged := mergeValues(base, override)
+			if !reflect.DeepEqual(merged, parse(test.want)) {
+				t.Errorf("mergeValues() = %v, want %s", merged, test.want)
+			}
+			if !reflect.DeepEqual(base, parse(test.base)) || !reflect.DeepEqual(override, parse(test.override)) {
+				t.Errorf("mergeValues() modified its arguments: %v, %v", base, override)
+			}
+		})
+	}
+}
+
+func TestMergeValuesCopiesNestedMaps(t *testing.T) {
+	override := map[string]interface{}{"nested": map[string]interface{}{"a": 1}}
+	merged := mergeValues(nil, override)
+	merged["nested"].(map[string]interface{})["a"] = 2
+	if override["nested"].(map[string]interface{})["a"] != 1 {
+		t.Errorf("Modifying the merged values modified the values they were merged from")
+	}
+}
+
+func TestSDKValuesOrder(t *testing.T) {
+	l := loadTestProjectWithSettings(t, `
+apiVersion: helm-hog.meln5674.github.com/v1alpha1
+kind: Project
+chart: testdata/chart
+parts:
+  first: {replicas: 1, config: {greeting: first, extra: {first: "yes"}}}
+  second: {replicas: 2, config: {greeting: second}}
+  neither: {}
+variables:
+  early: {first: [first], second: [second], both: [second, first]}
+  late: {first: [first], second: [second], neither: [neither]}
+`, ProjectSettings{Engine: EngineSDK})
+	err := l.sdkLoad()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		c    Case
+		want string
+	}{
+		{
+			c:    Case{"early": "first", "late": "second"},
+			want: `{replicas: 2, config: {greeting: second, extra: {first: "yes"}}}`,
+		},
+		{
+			c:    Case{"early": "second", "late": "first"},
+			want: `{replicas: 1, config: {greeting: first, extra: {first: "yes"}}}`,
+		},
+		{
+			c:    Case{"early": "both", "late": "neither"},
+			want: `{replicas: 1, config: {greeting: first, extra: {first: "yes"}}}`,
+		},
+	}
+	for _, test := range tests {
+		want := make(map[string]interface{})
+		err := yaml.Unmarshal([]byte(test.want), &want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		values := l.sdkValues(test.c)
+		if !reflect.DeepEqual(values, want) {
+			t.Errorf("sdkValues(%s) = %v, want %s", l.CaseID(test.c), values, test.want)
+		}
+	}
+}
+
+func TestEnginesRenderIdentically(t *testing.T) {
+	if _, err := exec.LookPath("helm"); err != nil {
+		t.Skip("helm is not available")
+	}
+	cases := []Case{
+		{"greeting": "default", "scale": "single", "config": "default"},
+		{"greeting": "default", "scale": "replicated", "config": "extra"},
+	}
+	render := func(engine Engine, c Case) string {
+		l := loadTestProjectWithSettings(t, chartTestProject, ProjectSettings{Engine: engine})
+		err := RunContext(context.Background(), l.Template(c))
+		if err != nil {
+			t.Fatalf("render %s with the %s engine: %v", l.CaseID(c), engine, err)
+		}
+		manifests, err := os.ReadFile(l.TemplateOutPath(c))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(manifests)
+	}
+	for _, c := range cases {
+		cli := render(EngineCLI, c)
+		sdk := render(EngineSDK, c)
+		if cli != sdk {
+			t.Errorf("Engines rendered different manifests for %v\n%s:\n%s\n%s:\n%s", c, EngineCLI, cli, EngineSDK, sdk)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package helmhog
+
+import (
+	"fmt"
+	"strings"
+)
+
+type SelectorName = string
+
+const (
+	selectorSeparator       = ","
+	selectorChoiceSeparator = "|"
+	selectorEqual           = "="
+	selectorNot             = "!"
+	selectorNotEqual        = selectorNot + selectorEqual
+)
+
+// A Predicate matches cases which map a variable to one of a set of choices, or, if negated, to none of them
+type Predicate struct {
+	Variable VariableName
+	ChoiceSet
+}
+
+func (p Predicate) Matches(c Case) bool {
+	return p.ChoiceSet.Matches(c[p.Variable])
+}
+
+func (p Predicate) String() string {
+	op := selectorEqual
+	if p.Negate {
+		op = selectorNotEqual
+	}
+	return p.Variable + op + strings.Join(p.Choices, selectorChoiceSeparator)
+}
+
+// A Selector matches cases which match all of its predicates
+type Selector []Predicate
+
+// ParseSelector parses a comma-separated list of predicates, each of which is either
+// variable=choice or variable!=choice, where choice may also be a |-separated set of choices, e.g.
+// database=postgres|mysql,ingress!=none
+func ParseSelector(expr string) (Selector, error) {
+	s := make(Selector, 0)
+	for _, term := range strings.Split(expr, selectorSeparator) {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+		var p Predicate
+		var choices string
+		var ok bool
+		if p.Variable, choices, ok = strings.Cut(term, selectorNotEqual); ok {
+			p.Negate = true
+		} else if p.Variable, choices, ok = strings.Cut(term, selectorEqual); !ok {
+			return nil, fmt.Errorf("Invalid predicate %s, expected variable%schoice or variable%schoice", term, selectorEqual, selectorNotEqual)
+		}
+		p.Variable = strings.TrimSpace(p.Variable)
+		for _, choice := range strings.Split(choices, selectorChoiceSeparator) {
+			p.Choices = append(p.Choices, strings.TrimSpace(choice))
+		}
+		s = append(s, p)
+	}
+	return s, nil
+}
+
+func (s Selector) Matches(c Case) bool {
+	for _, p := range s {
+		if !p.Matches(c) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s Selector) String() string {
+	terms := make([]string, 0, len(s))
+	for _, p := range s {
+		terms = append(terms, p.String())
+	}
+	return strings.Join(terms, selectorSeparator)
+}
+
+// Check ensures that a selector only refers to variables and choices that exist in the project
+func (s Selector) Check(p *Project) error {
+	for _, pred := range s {
+		if _, ok := p.Variables[pred.Variable]; !ok {
+			return fmt.Errorf("Undefined variable %s", pred.Variable)
+		}
+		for _, choice := range pred.Choices {
+			if _, ok := p.Variables[pred.Variable][choice]; !ok {
+				return fmt.Errorf("Variable %s has no choice %s", pred.Variable, choice)
+			}
+		}
+	}
+	return nil
+}
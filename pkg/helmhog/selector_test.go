@@ -0,0 +1,126 @@
+package helmhog
+
+import (
+	"strings"
+	"testing"
+
+	"sigs.k8s.io/yaml"
+)
+
+const selectorTestProject = `
+apiVersion: helm-hog.meln5674.github.com/v1alpha1
+kind: Project
+parts:
+  p: {}
+variables:
+  db: {postgres: [p], mysql: [p], none: [p]}
+  ingress: {nginx: [p], none: [p]}
+selectors:
+  external-db: 'db!=none'
+`
+
+func TestSelector(t *testing.T) {
+	l := loadTestProject(t, selectorTestProject)
+	tests := []struct {
+		expr string
+		// matches are the IDs of the cases the selector matches, in generation order
+		matches []string
+		err     string
+	}{
+		{
+			expr:    "db=postgres",
+			matches: []string{"db=postgres,ingress=nginx", "db=postgres,ingress=none"},
+		},
+		{
+			expr:    " db = mysql | postgres , ingress != none ",
+			matches: []string{"db=mysql,ingress=nginx", "db=postgres,ingress=nginx"},
+		},
+		{
+			expr:    "db!=mysql|postgres",
+			matches: []string{"db=none,ingress=nginx", "db=none,ingress=none"},
+		},
+		{
+			expr:    "db=none,db=mysql",
+			matches: []string{},
+		},
+		{
+			expr:    "",
+			matches: []string{"db=mysql,ingress=nginx", "db=mysql,ingress=none", "db=none,ingress=nginx", "db=none,ingress=none", "db=postgres,ingress=nginx", "db=postgres,ingress=none"},
+		},
+		{
+			expr: "db",
+			err:  "Invalid predicate db",
+		},
+		{
+			expr: "cache=redis",
+			err:  "Undefined variable cache",
+		},
+		{
+			expr: "db=sqlite",
+			err:  "Variable db has no choice sqlite",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			selector, err := ParseSelector(test.expr)
+			if err == nil {
+				err = selector.Check(l.Project)
+			}
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error containing %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			reparsed, err := ParseSelector(selector.String())
+			if err != nil || reparsed.String() != selector.String() {
+				t.Errorf("%s did not round trip, got %s, %v", selector, reparsed, err)
+			}
+			cases := make(chan Case)
+			go l.GenerateCases(cases)
+			matches := make([]string, 0)
+			for c := range cases {
+				if selector.Matches(c) {
+					matches = append(matches, l.CaseID(c))
+				}
+			}
+			if strings.Join(matches, " ") != strings.Join(test.matches, " ") {
+				t.Errorf("%s matched %v, want %v", test.expr, matches, test.matches)
+			}
+		})
+	}
+}
+
+func TestLoadRejectsNamesSelectorsCannotExpress(t *testing.T) {
+	tests := []struct {
+		name      string
+		variables string
+	}{
+		{name: "comma in variable", variables: `{"a,b": {x: [p]}}`},
+		{name: "equals in choice", variables: `{a: {"x=y": [p]}}`},
+		{name: "not in variable", variables: `{"a!": {x: [p]}}`},
+		{name: "pipe in choice", variables: `{a: {"x|y": [p]}}`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := new(Project)
+			err := yaml.Unmarshal([]byte(`
+apiVersion: helm-hog.meln5674.github.com/v1alpha1
+kind: Project
+parts:
+  p: {}
+variables: `+test.variables), p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			l, err := p.Load(ProjectSettings{})
+			if err == nil {
+				l.RemoveTempDir()
+				t.Fatal("expected project to be rejected")
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+package helmhog
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// maxSignatureLength is the length signatures are truncated to, as some tools print entire objects in their errors
+	maxSignatureLength = 200
+)
+
+var (
+	signatureLineNumbers = regexp.MustCompile(`(\.[A-Za-z0-9]+):\d+(:\d+)?`)
+	signatureLineWords   = regexp.MustCompile(`(?i)\b(line|column|col|document|index)\s+\d+`)
+	signaturePaths       = regexp.MustCompile(`(^|[\s"'(=\[])/[^\s"'():,\]]+`)
+	signatureQuoted      = regexp.MustCompile(`"[^"]*"`)
+	signatureNumbers     = regexp.MustCompile(`\b\d+\b`)
+	signatureSpaces      = regexp.MustCompile(`\s+`)
+	// signatureDebug matches the lines helm writes to stderr with --debug, e.g. install.go:200: [debug] Original chart version: ""
+	signatureDebug = regexp.MustCompile(`^([A-Za-z0-9_.]+\.go:\d+: )?\[debug\]`)
+)
+
+// NormalizeError removes the parts of an error message which are specific to a case, such as paths, line numbers,
+// namespaces, and values, so that cases which failed for the same reason produce the same message
+func (l *LoadedProject) NormalizeError(message string) string {
+	message = strings.TrimSpace(message)
+	message = strings.TrimPrefix(message, "Error: ")
+	message = strings.TrimPrefix(message, "[ERROR] ")
+	if l.TempDir != "" {
+		namespaces := regexp.MustCompile(regexp.QuoteMeta(filepath.Base(l.TempDir)) + `-[0-9a-f]+`)
+		message = namespaces.ReplaceAllString(message, "<namespace>")
+	}
+	message = signatureLineNumbers.ReplaceAllString(message, "$1")
+	message = signatureLineWords.ReplaceAllString(message, "$1 N")
+	message = signaturePaths.ReplaceAllString(message, "$1<path>")
+	message = signatureQuoted.ReplaceAllString(message, `"<value>"`)
+	message = signatureNumbers.ReplaceAllString(message, "N")
+	message = signatureSpaces.ReplaceAllString(message, " ")
+	if len(message) > maxSignatureLength {
+		message = message[:maxSignatureLength] + "..."
+	}
+	return message
+}
+
+// firstErrorLine returns the first line of a file which is an error, or the first non-empty line if onlyErrors is false.
+// Debug lines are never returned, as helm writes them whether or not it failed.
+func firstErrorLine(path string, onlyErrors bool) string {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(contents), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || signatureDebug.MatchString(line) {
+			continue
+		}
+		if !onlyErrors || strings.HasPrefix(line, "[ERROR]") || strings.HasPrefix(line, "Error") {
+			return line
+		}
+	}
+	return ""
+}
+
+// FailureSignature identifies the cause of a failed case, so that cases which failed for the same reason can be grouped.
+// It is the normalized first error from the case's template.err, lint.out, apply.err, or findings.json, in that order,
+// or of the error it failed with if none of those contain one. It is empty for cases which passed.
+// Only lines of template.err which are errors are used, as helm also writes debug output and warnings there when rendering succeeds.
+func (l *LoadedProject) FailureSignature(c Case, err error) string {
+	if err == nil {
+		return ""
+	}
+	line := firstErrorLine(l.TemplateErrPath(c), true)
+	if line == "" {
+		line = firstErrorLine(l.LintOutPath(c), true)
+	}
+	if line == "" {
+		line = firstErrorLine(l.ApplyErrPath(c), false)
+	}
+	if line == "" {
+		var findings []Finding
+		findingsJSON, readErr := os.ReadFile(l.FindingsPath(c))
+		if readErr == nil && json.Unmarshal(findingsJSON, &findings) == nil && len(findings) != 0 {
+			line = findings[0].String()
+		}
+	}
+	if line == "" {
+		line = strings.TrimSpace(err.Error())
+		if ix := strings.Index(line, "\n"); ix != -1 {
+			line = line[:ix]
+		}
+	}
+	return l.NormalizeError(line)
+}
+
+// A FailureGroup is a set of failed cases with the same failure signature
+type FailureGroup struct {
+	Signature string
+	// Cases are sorted by case ID
+	Cases []Case
+	// Common are the mappings which every case in the group has
+	Common Case
+}
+
+// GroupFailures groups the failed results by their failure signature, in descending order of the number of cases in each group
+func (l *LoadedProject) GroupFailures(results []CaseResult) []*FailureGroup {
+	groups := make(map[string]*FailureGroup)
+	for _, result := range l.sortedResults(results) {
+		if !result.Status.Failed() {
+			continue
+		}
+		signature := l.FailureSignature(result.Case, result.Err)
+		group, ok := groups[signature]
+		if !ok {
+			group = &FailureGroup{Signature: signature, Common: make(Case, len(result.Case))}
+			for name, choice := range result.Case {
+				group.Common[name] = choice
+			}
+			groups[signature] = group
+		}
+		group.Cases = append(group.Cases, result.Case)
+		for name, choice := range group.Common {
+			if result.Case[name] != choice {
+				delete(group.Common, name)
+			}
+		}
+	}
+	sorted := make([]*FailureGroup, 0, len(groups))
+	for _, group := range groups {
+		sorted = append(sorted, group)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if len(sorted[i].Cases) != len(sorted[j].Cases) {
+			return len(sorted[i].Cases) > len(sorted[j].Cases)
+		}
+		return sorted[i].Signature < sorted[j].Signature
+	})
+	return sorted
+}
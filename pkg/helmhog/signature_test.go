@@ -0,0 +1,215 @@
+package helmhog
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+const signatureTestProject = `
+apiVersion: helm-hog.meln5674.github.com/v1alpha1
+kind: Project
+parts:
+  p: {}
+variables:
+  a: {x: [p], y: [p]}
+  b: {x: [p], y: [p]}
+`
+
+func TestNormalizeError(t *testing.T) {
+	l := loadTestProject(t, signatureTestProject)
+	namespace := l.CaseNamespace(Case{"a": "x", "b": "y"})
+	otherNamespace := l.CaseNamespace(Case{"a": "y", "b": "x"})
+	tests := []struct {
+		name string
+		// messages are the outputs of different cases which failed for the same reason
+		messages []string
+		want     string
+	}{
+		{
+			name: "helm template",
+			messages: []string{
+				`Error: template: demo/templates/configmap.yaml:6:14: executing "demo/templates/configmap.yaml" at <.Values.config.name>: nil pointer evaluating interface {}.name`,
+				`Error: template: demo/templates/configmap.yaml:9:3: executing "demo/templates/configmap.yaml" at <.Values.config.name>: nil pointer evaluating interface {}.name`,
+			},
+			want: `template: demo/templates/configmap.yaml: executing "<value>" at <.Values.config.name>: nil pointer evaluating interface {}.name`,
+		},
+		{
+			name: "helm template yaml",
+			messages: []string{
+				`Error: YAML parse error on demo/templates/deployment.yaml: error converting YAML to JSON: yaml: line 12: did not find expected key`,
+				`Error: YAML parse error on demo/templates/deployment.yaml: error converting YAML to JSON: yaml: line 31: did not find expected key`,
+			},
+			want: `YAML parse error on demo/templates/deployment.yaml: error converting YAML to JSON: yaml: line N: did not find expected key`,
+		},
+		{
+			name: "helm lint",
+			messages: []string{
+				`[ERROR] templates/configmap.yaml: template: demo/templates/configmap.yaml:6:14: executing "demo/templates/configmap.yaml" at <.Values.config.name>: nil pointer evaluating interface {}.name`,
+			},
+			want: `templates/configmap.yaml: template: demo/templates/configmap.yaml: executing "<value>" at <.Values.config.name>: nil pointer evaluating interface {}.name`,
+		},
+		{
+			name: "helm install",
+			messages: []string{
+				`Error: INSTALL FAILED: failed to create resource: namespaces "` + namespace + `" not found`,
+				`Error: INSTALL FAILED: failed to create resource: namespaces "` + otherNamespace + `" not found`,
+			},
+			want: `INSTALL FAILED: failed to create resource: namespaces "<value>" not found`,
+		},
+		{
+			// Signatures are truncated, as some tools print entire objects
+			name: "kubectl client",
+			messages: []string{
+				`error: error validating "STDIN": error validating data: ValidationError(Deployment.spec.replicas): invalid type for io.k8s.api.apps.v1.DeploymentSpec.replicas: got "string", expected "integer"; if you choose to ignore these errors, turn validation off with --validate=false`,
+			},
+			want: `error: error validating "<value>": error validating data: ValidationError(Deployment.spec.replicas): invalid type for io.k8s.api.apps.v1.DeploymentSpec.replicas: got "<value>", expected "<value>"; if ...`,
+		},
+		{
+			name: "kubectl server",
+			messages: []string{
+				`Error from server (Invalid): error when creating "STDIN": Deployment.apps "demo" is invalid: spec.replicas: Invalid value: -1: must be greater than or equal to 0`,
+				`Error from server (Invalid): error when creating "STDIN": Deployment.apps "other" is invalid: spec.replicas: Invalid value: -3: must be greater than or equal to 0`,
+			},
+			want: `Error from server (Invalid): error when creating "<value>": Deployment.apps "<value>" is invalid: spec.replicas: Invalid value: -N: must be greater than or equal to N`,
+		},
+		{
+			name: "kubectl namespace",
+			messages: []string{
+				`Error from server (Forbidden): error when creating "STDIN": configmaps "demo" is forbidden: unable to create new content in namespace ` + namespace + ` because it is being terminated`,
+				`Error from server (Forbidden): error when creating "STDIN": configmaps "demo" is forbidden: unable to create new content in namespace ` + otherNamespace + ` because it is being terminated`,
+			},
+			want: `Error from server (Forbidden): error when creating "<value>": configmaps "<value>" is forbidden: unable to create new content in namespace <namespace> because it is being terminated`,
+		},
+		{
+			name: "kubeconform",
+			messages: []string{
+				`stdin - Deployment demo is invalid: problem validating schema. Check JSON formatting: jsonschema: '/spec/replicas' does not validate with /tmp/schemas/v1.27.3-standalone-strict/deployment-apps-v1.json#/properties/spec/properties/replicas/type: expected integer or null, but got string`,
+				`stdin - Deployment demo is invalid: problem validating schema. Check JSON formatting: jsonschema: '/spec/replicas' does not validate with /home/ci/schemas/v1.27.3-standalone-strict/deployment-apps-v1.json#/properties/spec/properties/replicas/type: expected integer or null, but got string`,
+			},
+			want: `stdin - Deployment demo is invalid: problem validating schema. Check JSON formatting: jsonschema: '<path>' does not validate with <path>: expected integer or null, but got string`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, message := range test.messages {
+				got := l.NormalizeError(message)
+				if got != test.want {
+					t.Errorf("NormalizeError(%q)\n got: %s\nwant: %s", message, got, test.want)
+				}
+			}
+		})
+	}
+}
+
+func TestFailureSignatureIgnoresDebugOutput(t *testing.T) {
+	l := loadTestProject(t, signatureTestProject)
+	// helm template --debug writes these to stderr for every case, whether or not rendering succeeds
+	debug := "install.go:200: [debug] Original chart version: \"\"\n" +
+		"install.go:217: [debug] CHART PATH: /tmp/helm-hog-123/chart\n" +
+		"\n" +
+		"coalesce.go:289: warning: destination for demo.config is a table. Ignoring non-table value ([])\n"
+	tests := []struct {
+		name        string
+		c           Case
+		templateErr string
+		applyErr    string
+		want        string
+	}{
+		{
+			name: "template failed",
+			c:    Case{"a": "x", "b": "x"},
+			templateErr: debug +
+				"Error: template: demo/templates/configmap.yaml:6:14: executing \"demo/templates/configmap.yaml\" at <.Values.config.name>: nil pointer evaluating interface {}.name\n" +
+				"helm.go:84: [debug] template: demo/templates/configmap.yaml:6:14: executing \"demo/templates/configmap.yaml\" at <.Values.config.name>: nil pointer evaluating interface {}.name\n",
+			want: `template: demo/templates/configmap.yaml: executing "<value>" at <.Values.config.name>: nil pointer evaluating interface {}.name`,
+		},
+		{
+			name:        "apply failed",
+			c:           Case{"a": "x", "b": "y"},
+			templateErr: debug,
+			applyErr:    `Error from server (Invalid): error when creating "STDIN": Deployment.apps "demo" is invalid: spec.replicas: Invalid value: -1: must be greater than or equal to 0` + "\n",
+			want:        `Error from server (Invalid): error when creating "<value>": Deployment.apps "<value>" is invalid: spec.replicas: Invalid value: -N: must be greater than or equal to N`,
+		},
+		{
+			name:        "other apply failure",
+			c:           Case{"a": "y", "b": "x"},
+			templateErr: debug,
+			applyErr:    `error: error parsing STDIN: error converting YAML to JSON: yaml: line 4: mapping values are not allowed in this context` + "\n",
+			want:        `error: error parsing STDIN: error converting YAML to JSON: yaml: line N: mapping values are not allowed in this context`,
+		},
+		{
+			name:        "no output",
+			c:           Case{"a": "y", "b": "y"},
+			templateErr: debug,
+			want:        `exit status N`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := l.MakeCaseTempDir(test.c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = os.WriteFile(l.TemplateErrPath(test.c), []byte(test.templateErr), 0600)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.applyErr != "" {
+				err = os.WriteFile(l.ApplyErrPath(test.c), []byte(test.applyErr), 0600)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			got := l.FailureSignature(test.c, errors.New("exit status 1"))
+			if got != test.want {
+				t.Errorf("FailureSignature()\n got: %s\nwant: %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestGroupFailures(t *testing.T) {
+	l := loadTestProject(t, signatureTestProject)
+	nilPointer := errors.New(`template: demo/templates/configmap.yaml:6:14: executing "demo/templates/configmap.yaml" at <.Values.config.name>: nil pointer evaluating interface {}.name`)
+	results := []CaseResult{
+		{Case: Case{"a": "y", "b": "y"}, Status: CaseStatusFailed, Err: nilPointer},
+		{Case: Case{"a": "x", "b": "x"}, Status: CaseStatusPassed},
+		{Case: Case{"a": "x", "b": "y"}, Status: CaseStatusFailed, Err: errors.New(`template: demo/templates/configmap.yaml:9:2: executing "demo/templates/configmap.yaml" at <.Values.config.name>: nil pointer evaluating interface {}.name`)},
+		{Case: Case{"a": "y", "b": "x"}, Status: CaseStatusTimedOut, Err: &CaseTimeoutError{Timeout: time.Minute}},
+		{Case: Case{"a": "y", "b": "x"}, Status: CaseStatusSkipped},
+	}
+	groups := l.GroupFailures(results)
+	want := []struct {
+		signature string
+		cases     []string
+		common    string
+	}{
+		{
+			signature: l.NormalizeError(nilPointer.Error()),
+			cases:     []string{"a=x,b=y", "a=y,b=y"},
+			common:    "b=y",
+		},
+		{
+			signature: "Case did not finish within 1m0s",
+			cases:     []string{"a=y,b=x"},
+			common:    "a=y,b=x",
+		},
+	}
+	if len(groups) != len(want) {
+		t.Fatalf("Got %d groups, want %d", len(groups), len(want))
+	}
+	for ix, group := range groups {
+		if group.Signature != want[ix].signature {
+			t.Errorf("Group %d has signature %s, want %s", ix, group.Signature, want[ix].signature)
+		}
+		if caseIDs(l, group.Cases) != strings.Join(want[ix].cases, " ") {
+			t.Errorf("Group %d has cases %s, want %v", ix, caseIDs(l, group.Cases), want[ix].cases)
+		}
+		if l.CaseID(group.Common) != want[ix].common {
+			t.Errorf("Group %d has common mappings %s, want %s", ix, l.CaseID(group.Common), want[ix].common)
+		}
+	}
+}
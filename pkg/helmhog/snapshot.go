@@ -0,0 +1,190 @@
+package helmhog
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/pmezard/go-difflib/difflib"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// snapshotSecretPlaceholder replaces the values of Secrets in snapshots, as these are often randomly generated
+	snapshotSecretPlaceholder = "<secret>"
+	snapshotDiffContext       = 3
+)
+
+var (
+	// snapshotPodTemplatePaths are the paths to the templates within workloads, whose metadata is normalized like
+	// that of the workload itself, as this is where charts usually put checksums to restart pods when their config changes
+	snapshotPodTemplatePaths = [][]string{
+		// Deployments, StatefulSets, DaemonSets, ReplicaSets, and Jobs
+		{"spec", "template"},
+		// CronJobs
+		{"spec", "jobTemplate"},
+		{"spec", "jobTemplate", "spec", "template"},
+	}
+
+	// DefaultSnapshotStripAnnotations are the annotations removed from snapshots if a project does not specify any,
+	// as these are typically hashes of other rendered files
+	DefaultSnapshotStripAnnotations = []string{"checksum/*"}
+)
+
+// SnapshotNormalization controls how rendered manifests are normalized before being compared to snapshots,
+// so that volatile fields do not cause spurious differences
+type SnapshotNormalization struct {
+	// StripAnnotations and StripLabels are glob patterns, as used by path.Match, of the annotation and label keys
+	// to remove from every object
+	StripAnnotations []string `json:"stripAnnotations,omitempty"`
+	StripLabels      []string `json:"stripLabels,omitempty"`
+	// KeepSecretData disables replacing the values of the data and stringData of Secrets with a placeholder
+	KeepSecretData bool `json:"keepSecretData,omitempty"`
+}
+
+// stripKeys removes every key from a map field of an object which matches any of a set of patterns
+func stripKeys(obj map[string]interface{}, field string, patterns []string) {
+	metadata, ok := obj["metadata"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	values, ok := metadata[field].(map[string]interface{})
+	if !ok {
+		return
+	}
+	for key := range values {
+		for _, pattern := range patterns {
+			if matched, _ := path.Match(pattern, key); matched {
+				delete(values, key)
+				break
+			}
+		}
+	}
+	if len(values) == 0 {
+		delete(metadata, field)
+	}
+}
+
+// podTemplates returns the templates within a workload which have their own metadata
+func podTemplates(obj map[string]interface{}) []map[string]interface{} {
+	templates := make([]map[string]interface{}, 0, 1)
+	for _, fields := range snapshotPodTemplatePaths {
+		if template, ok := getMap(obj, fields...); ok {
+			templates = append(templates, template)
+		}
+	}
+	return templates
+}
+
+// getMap returns a nested map field of an object, if it exists
+func getMap(obj map[string]interface{}, fields ...string) (map[string]interface{}, bool) {
+	current := obj
+	for _, field := range fields {
+		next, ok := current[field].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		current = next
+	}
+	return current, true
+}
+
+// NormalizeManifests converts rendered manifests into a canonical form for snapshots, with keys in sorted order,
+// comments and empty documents removed, and volatile fields removed or replaced according to the project's normalization
+func (l *LoadedProject) NormalizeManifests(manifests []byte) ([]byte, error) {
+	docs, err := readDocuments(bytes.NewReader(manifests))
+	if err != nil {
+		return nil, err
+	}
+	stripAnnotations := l.Snapshots.StripAnnotations
+	if stripAnnotations == nil {
+		stripAnnotations = DefaultSnapshotStripAnnotations
+	}
+	var normalized bytes.Buffer
+	for ix, doc := range docs {
+		obj := make(map[string]interface{})
+		err = yaml.Unmarshal(doc, &obj)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("parse document %d", ix))
+		}
+		for _, o := range append([]map[string]interface{}{obj}, podTemplates(obj)...) {
+			stripKeys(o, "annotations", stripAnnotations)
+			stripKeys(o, "labels", l.Snapshots.StripLabels)
+		}
+		if obj["kind"] == "Secret" && !l.Snapshots.KeepSecretData {
+			for _, field := range []string{"data", "stringData"} {
+				if data, ok := obj[field].(map[string]interface{}); ok {
+					for key := range data {
+						data[key] = snapshotSecretPlaceholder
+					}
+				}
+			}
+		}
+		objBytes, err := yaml.Marshal(obj)
+		if err != nil {
+			return nil, err
+		}
+		normalized.WriteString("---\n")
+		normalized.Write(objBytes)
+	}
+	return normalized.Bytes(), nil
+}
+
+// SnapshotPath returns the path to the snapshot of a case within a snapshot directory
+func (l *LoadedProject) SnapshotPath(dir string, c Case) string {
+	return filepath.Join(dir, l.CaseID(c)+".yaml")
+}
+
+func (l *LoadedProject) SnapshotDiffPath(c Case) string {
+	return l.TempPath(c, "snapshot.diff")
+}
+
+// CheckSnapshot compares the normalized rendered manifests of a case to its snapshot, returning an error containing
+// a diff if they differ. If update is true, the snapshot is instead replaced with the rendered manifests.
+func (l *LoadedProject) CheckSnapshot(c Case, dir string, update bool) error {
+	manifests, err := os.ReadFile(l.TemplateOutPath(c))
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("read file %s", l.TemplateOutPath(c)))
+	}
+	actual, err := l.NormalizeManifests(manifests)
+	if err != nil {
+		return errors.Wrap(err, "normalize rendered manifests")
+	}
+	snapshotPath := l.SnapshotPath(dir, c)
+	if update {
+		err = os.MkdirAll(dir, 0755)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(snapshotPath, actual, 0644)
+	}
+	expected, err := os.ReadFile(snapshotPath)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("No snapshot found at %s, use --update-snapshots to create it", snapshotPath)
+	}
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("read file %s", snapshotPath))
+	}
+	if bytes.Equal(expected, actual) {
+		return nil
+	}
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(expected)),
+		B:        difflib.SplitLines(string(actual)),
+		FromFile: snapshotPath,
+		ToFile:   l.TemplateOutPath(c),
+		Context:  snapshotDiffContext,
+	})
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(l.SnapshotDiffPath(c), []byte(diff), 0600)
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("Rendered manifests differ from snapshot %s, use --update-snapshots to accept the changes:\n%s", snapshotPath, strings.TrimSpace(diff))
+}
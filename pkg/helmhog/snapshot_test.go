@@ -0,0 +1,171 @@
+package helmhog
+
+import (
+	"testing"
+)
+
+const snapshotTestProject = `
+apiVersion: helm-hog.meln5674.github.com/v1alpha1
+kind: Project
+parts:
+  p: {}
+variables:
+  a: {x: [p]}
+`
+
+func TestNormalizeManifests(t *testing.T) {
+	tests := []struct {
+		name      string
+		project   string
+		manifests string
+		want      string
+	}{
+		{
+			name:    "deployment",
+			project: snapshotTestProject,
+			manifests: `
+# Source: demo/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: demo
+  annotations:
+    checksum/config: abc123
+  labels:
+    app: demo
+spec:
+  template:
+    metadata:
+      annotations:
+        checksum/config: abc123
+        prometheus.io/scrape: "true"
+      labels:
+        app: demo
+    spec:
+      containers:
+      - name: demo
+        image: demo
+`,
+			want: `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  labels:
+    app: demo
+  name: demo
+spec:
+  template:
+    metadata:
+      annotations:
+        prometheus.io/scrape: "true"
+      labels:
+        app: demo
+    spec:
+      containers:
+      - image: demo
+        name: demo
+`,
+		},
+		{
+			name: "cronjob",
+			project: snapshotTestProject + `
+snapshots:
+  stripAnnotations: [checksum/*, rollme]
+  stripLabels: [helm.sh/chart]
+`,
+			manifests: `
+apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: demo
+  labels:
+    helm.sh/chart: demo-0.1.0
+spec:
+  schedule: '@daily'
+  jobTemplate:
+    metadata:
+      labels:
+        helm.sh/chart: demo-0.1.0
+    spec:
+      template:
+        metadata:
+          annotations:
+            checksum/secret: def456
+            rollme: xyz
+          labels:
+            helm.sh/chart: demo-0.1.0
+            app: demo
+        spec:
+          restartPolicy: Never
+`,
+			want: `---
+apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: demo
+spec:
+  jobTemplate:
+    metadata: {}
+    spec:
+      template:
+        metadata:
+          labels:
+            app: demo
+        spec:
+          restartPolicy: Never
+  schedule: '@daily'
+`,
+		},
+		{
+			name:    "secret",
+			project: snapshotTestProject,
+			manifests: `
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: demo
+data:
+  password: cmFuZG9t
+stringData:
+  token: random
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: demo
+data:
+  password: kept
+`,
+			want: `---
+apiVersion: v1
+data:
+  password: <secret>
+kind: Secret
+metadata:
+  name: demo
+stringData:
+  token: <secret>
+---
+apiVersion: v1
+data:
+  password: kept
+kind: ConfigMap
+metadata:
+  name: demo
+`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l := loadTestProject(t, test.project)
+			normalized, err := l.NormalizeManifests([]byte(test.manifests))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(normalized) != test.want {
+				t.Errorf("got:\n%s\nwant:\n%s", normalized, test.want)
+			}
+		})
+	}
+}
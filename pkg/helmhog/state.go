@@ -0,0 +1,131 @@
+package helmhog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	StateFileName = "state.json"
+)
+
+// StateCase is a case recorded in a State
+type StateCase struct {
+	ID       string     `json:"id"`
+	Hash     string     `json:"hash"`
+	Mappings MappingSet `json:"mappings"`
+}
+
+// State records the cases which did not pass in a test run, so that they can be re-run
+type State struct {
+	// Project is the absolute path to the project file of the run, so that the latest state of a project can be found
+	Project string      `json:"project"`
+	Failed  []StateCase `json:"failed"`
+	Skipped []StateCase `json:"skipped"`
+}
+
+func (l *LoadedProject) StatePath() string {
+	return filepath.Join(l.TempDir, StateFileName)
+}
+
+func (l *LoadedProject) stateCases(cases []Case) []StateCase {
+	stateCases := make([]StateCase, 0, len(cases))
+	for _, c := range cases {
+		stateCases = append(stateCases, StateCase{
+			ID:       l.CaseID(c),
+			Hash:     l.CaseHash(c),
+			Mappings: MappingSet(c),
+		})
+	}
+	return stateCases
+}
+
+// NewState records a set of failed and skipped cases of the project at a path
+func (l *LoadedProject) NewState(projectPath string, failed, skipped []Case) (*State, error) {
+	absProjectPath, err := filepath.Abs(projectPath)
+	if err != nil {
+		return nil, err
+	}
+	return &State{
+		Project: absProjectPath,
+		Failed:  l.stateCases(failed),
+		Skipped: l.stateCases(skipped),
+	}, nil
+}
+
+// StateCases returns the failed and skipped cases in a state, checking that they are still valid and allowed by the project
+func (l *LoadedProject) StateCases(s *State) ([]Case, error) {
+	cases := make([]Case, 0, len(s.Failed)+len(s.Skipped))
+	for _, stateCases := range [][]StateCase{s.Failed, s.Skipped} {
+		for _, stateCase := range stateCases {
+			c, err := l.ParseCaseID(l.CaseID(Case(stateCase.Mappings)))
+			if err != nil {
+				return nil, errors.Wrap(err, fmt.Sprintf("case %s is no longer valid", stateCase.ID))
+			}
+			if !l.Allows(c) {
+				return nil, fmt.Errorf("Case %s is no longer allowed by the project's rules", stateCase.ID)
+			}
+			cases = append(cases, c)
+		}
+	}
+	return cases, nil
+}
+
+func (s *State) Write(path string) error {
+	stateBytes, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "marshal state")
+	}
+	return os.WriteFile(path, stateBytes, 0600)
+}
+
+func ReadState(path string) (*State, error) {
+	stateBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("read file %s", path))
+	}
+	s := new(State)
+	err = json.Unmarshal(stateBytes, s)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("parse state %s", path))
+	}
+	return s, nil
+}
+
+// FindLatestState returns the path to the most recently written state file of the project at a path
+// in any project temp directory. State files of other projects are ignored.
+func FindLatestState(projectPath string) (string, error) {
+	absProjectPath, err := filepath.Abs(projectPath)
+	if err != nil {
+		return "", err
+	}
+	paths, err := filepath.Glob(filepath.Join(os.TempDir(), TempDirPattern, StateFileName))
+	if err != nil {
+		return "", err
+	}
+	latest := ""
+	var latestInfo os.FileInfo
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if latestInfo != nil && !info.ModTime().After(latestInfo.ModTime()) {
+			continue
+		}
+		s, err := ReadState(path)
+		if err != nil || s.Project != absProjectPath {
+			continue
+		}
+		latest = path
+		latestInfo = info
+	}
+	if latest == "" {
+		return "", fmt.Errorf("No state files for project %s found in %s", absProjectPath, os.TempDir())
+	}
+	return latest, nil
+}
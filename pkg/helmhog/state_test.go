@@ -0,0 +1,114 @@
+package helmhog
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStateRoundTrip(t *testing.T) {
+	l := loadTestProject(t, selectorTestProject)
+	failed := []Case{{"db": "postgres", "ingress": "none"}}
+	skipped := []Case{{"db": "mysql", "ingress": "nginx"}, {"db": "none", "ingress": "none"}}
+	state, err := l.NewState("hog.yaml", failed, skipped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !filepath.IsAbs(state.Project) || filepath.Base(state.Project) != "hog.yaml" {
+		t.Errorf("State project is %s, want an absolute path to hog.yaml", state.Project)
+	}
+	err = state.Write(l.StatePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadState(l.StatePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.Project != state.Project {
+		t.Errorf("Read project %s, want %s", read.Project, state.Project)
+	}
+	if len(read.Failed) != 1 || read.Failed[0].ID != "db=postgres,ingress=none" || read.Failed[0].Hash != l.CaseHash(failed[0]) {
+		t.Errorf("Read failed cases %v", read.Failed)
+	}
+	cases, err := l.StateCases(read)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append(append([]Case{}, failed...), skipped...)
+	if caseIDs(l, cases) != caseIDs(l, want) {
+		t.Errorf("State cases are %s, want %s", caseIDs(l, cases), caseIDs(l, want))
+	}
+
+	// A state from before the project changed may no longer be valid
+	read.Skipped[0].Mappings["db"] = "sqlite"
+	_, err = l.StateCases(read)
+	if err == nil || !strings.Contains(err.Error(), "case db=mysql,ingress=nginx is no longer valid") {
+		t.Errorf("expected invalid case error, got %v", err)
+	}
+	changed := loadTestProject(t, selectorTestProject+"restrictions: {no-db-or-ingress: {db: none, ingress: none}}\n")
+	read.Skipped[0].Mappings["db"] = "mysql"
+	_, err = changed.StateCases(read)
+	if err == nil || !strings.Contains(err.Error(), "Case db=none,ingress=none is no longer allowed") {
+		t.Errorf("expected disallowed case error, got %v", err)
+	}
+}
+
+func TestFindLatestState(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	l := loadTestProject(t, selectorTestProject)
+	now := time.Now()
+	// writeState writes a state for a project in a new temp directory, as if it was written some time ago
+	writeState := func(projectPath string, age time.Duration) string {
+		dir, err := os.MkdirTemp("", TempDirPattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, StateFileName)
+		state, err := l.NewState(projectPath, nil, []Case{{"db": "none", "ingress": "none"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = state.Write(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.Chtimes(path, now.Add(-age), now.Add(-age))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	_, err := FindLatestState("hog.yaml")
+	if err == nil || !strings.Contains(err.Error(), "No state files for project") {
+		t.Errorf("expected no state files error, got %v", err)
+	}
+
+	writeState("hog.yaml", 3*time.Hour)
+	latest := writeState("hog.yaml", 2*time.Hour)
+	writeState("other/hog.yaml", time.Hour)
+	writeState("hog-other.yaml", 0)
+
+	path, err := FindLatestState("hog.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != latest {
+		t.Errorf("FindLatestState() = %s, want %s", path, latest)
+	}
+	abs, err := filepath.Abs("hog.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, err = FindLatestState(abs)
+	if err != nil || path != latest {
+		t.Errorf("FindLatestState(%s) = %s, %v, want %s", abs, path, err, latest)
+	}
+	_, err = FindLatestState("missing.yaml")
+	if err == nil {
+		t.Errorf("Found state for a project which has none")
+	}
+}
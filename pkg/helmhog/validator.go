@@ -0,0 +1,303 @@
+package helmhog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/meln5674/gosh"
+	"github.com/pkg/errors"
+)
+
+type ValidatorName = string
+
+const (
+	// ValidatorLint runs helm lint against a case
+	ValidatorLint ValidatorName = "lint"
+	// ValidatorApply validates the rendered manifests of a case according to the apply mode
+	ValidatorApply ValidatorName = "apply"
+)
+
+var (
+	// DefaultValidators are the validators used if a project does not list any
+	DefaultValidators = []ValidatorName{ValidatorLint, ValidatorApply, ValidatorAssertions}
+)
+
+// A Finding is a problem with a case found by a Validator
+type Finding struct {
+	Validator ValidatorName `json:"validator"`
+	// Object optionally identifies the rendered object the finding is about, e.g. "Deployment my-app"
+	Object  string `json:"object,omitempty"`
+	Message string `json:"message"`
+}
+
+func (f Finding) String() string {
+	if f.Object != "" {
+		return fmt.Sprintf("%s: %s: %s", f.Validator, f.Object, f.Message)
+	}
+	return fmt.Sprintf("%s: %s", f.Validator, f.Message)
+}
+
+// A ValidationInput is what a Validator checks
+type ValidationInput struct {
+	Project *LoadedProject
+	Case    Case
+	// Manifests is the rendered output of the case, as written to its template.out,
+	// or nil for validators which do not need the manifests
+	Manifests []byte
+}
+
+// A Validator checks the rendered output of a case. The same Validator is used for every case, and may be
+// used for multiple cases at once.
+type Validator interface {
+	Name() ValidatorName
+	// NeedsManifests returns true if the validator checks the rendered manifests. Validators which do not,
+	// e.g. lint, are run alongside rendering, and are still run if rendering fails.
+	NeedsManifests() bool
+	// Validate returns the problems found with a case, any of which fails the case.
+	// An error means the validator could not check the case at all, which also fails the case.
+	Validate(ctx context.Context, in *ValidationInput) ([]Finding, error)
+}
+
+// A ValidatorFactory creates a Validator for a project
+type ValidatorFactory func(l *LoadedProject) (Validator, error)
+
+var (
+	validatorsLock sync.Mutex
+	validators     = make(map[ValidatorName]ValidatorFactory)
+)
+
+// RegisterValidator makes a validator available to projects by name. It is intended to be called from init functions,
+// and panics if a validator with the same name is already registered.
+func RegisterValidator(name ValidatorName, factory ValidatorFactory) {
+	validatorsLock.Lock()
+	defer validatorsLock.Unlock()
+	if _, ok := validators[name]; ok {
+		panic(fmt.Sprintf("Validator %s is already registered", name))
+	}
+	validators[name] = factory
+}
+
+// RegisteredValidators returns the names of every registered validator, in sorted order
+func RegisteredValidators() []ValidatorName {
+	validatorsLock.Lock()
+	defer validatorsLock.Unlock()
+	names := make([]ValidatorName, 0, len(validators))
+	for name := range validators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewValidator creates a registered validator for a project
+func (l *LoadedProject) NewValidator(name ValidatorName) (Validator, error) {
+	validatorsLock.Lock()
+	factory, ok := validators[name]
+	validatorsLock.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("Unknown validator %s, must be one of %s", name, strings.Join(RegisteredValidators(), ", "))
+	}
+	return factory(l)
+}
+
+// RunValidators renders a case, and runs each validator against it, returning all of their findings.
+// Findings are also written to the case's findings.json. Rendering and each validator are recorded as stages,
+// and a validator which returns findings is recorded as failed.
+// Validators which do not need the rendered manifests run alongside rendering, even if it fails, and the rest run
+// once it succeeds. Either way, validators run one at a time, and their findings are collected, then reported in
+// the order the validators are listed in, regardless of which finished first.
+func (l *LoadedProject) RunValidators(ctx context.Context, c Case, validators []Validator, stages *Stages) ([]Finding, error) {
+	findings := make([][]Finding, len(validators))
+	errs := make([]error, len(validators))
+	// runValidators runs each validator which does or does not need manifests, in order, until one of them errors
+	runValidators := func(in *ValidationInput, needsManifests bool) {
+		for ix, validator := range validators {
+			if validator.NeedsManifests() != needsManifests {
+				continue
+			}
+			stages.Run(validator.Name(), func() error {
+				findings[ix], errs[ix] = validator.Validate(ctx, in)
+				if errs[ix] != nil {
+					return errs[ix]
+				}
+				return FindingsError(findings[ix])
+			})
+			if errs[ix] != nil {
+				return
+			}
+		}
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		runValidators(&ValidationInput{Project: l, Case: c}, false)
+	}()
+	err := stages.Run(StageTemplate, func() error { return RunContext(ctx, l.Template(c)) })
+	if err == nil {
+		var manifests []byte
+		manifests, err = os.ReadFile(l.TemplateOutPath(c))
+		if err != nil {
+			err = errors.Wrap(err, fmt.Sprintf("read file %s", l.TemplateOutPath(c)))
+		} else {
+			runValidators(&ValidationInput{Project: l, Case: c, Manifests: manifests}, true)
+		}
+	}
+	wg.Wait()
+
+	allFindings := make([]Finding, 0)
+	for _, validatorFindings := range findings {
+		allFindings = append(allFindings, validatorFindings...)
+	}
+	if len(allFindings) != 0 {
+		findingsJSON, jsonErr := json.MarshalIndent(allFindings, "", "  ")
+		if jsonErr != nil {
+			return allFindings, jsonErr
+		}
+		writeErr := os.WriteFile(l.FindingsPath(c), findingsJSON, 0600)
+		if err == nil {
+			err = writeErr
+		}
+	}
+	if err != nil {
+		return allFindings, err
+	}
+	for ix, validator := range validators {
+		if errs[ix] != nil {
+			return allFindings, errors.Wrap(errs[ix], fmt.Sprintf("validator %s", validator.Name()))
+		}
+	}
+	return allFindings, nil
+}
+
+// FindingsError returns an error describing a case's findings, or nil if there are none
+func FindingsError(findings []Finding) error {
+	if len(findings) == 0 {
+		return nil
+	}
+	messages := make([]string, 0, len(findings))
+	for _, finding := range findings {
+		messages = append(messages, finding.String())
+	}
+	return fmt.Errorf("%d finding(s):\n%s", len(findings), strings.Join(messages, "\n"))
+}
+
+func (l *LoadedProject) FindingsPath(c Case) string {
+	return l.TempPath(c, "findings.json")
+}
+
+// outputFindings converts the output of a failed command into findings, one per non-empty line,
+// or a single finding of the command's error if there is no output
+func outputFindings(validator ValidatorName, output []byte, err error) []Finding {
+	findings := make([]Finding, 0)
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		findings = append(findings, Finding{Validator: validator, Message: line})
+	}
+	if len(findings) == 0 {
+		findings = append(findings, Finding{Validator: validator, Message: err.Error()})
+	}
+	return findings
+}
+
+// lintValidator runs helm lint, and reports each error it prints
+type lintValidator struct{}
+
+func (lintValidator) Name() ValidatorName {
+	return ValidatorLint
+}
+
+func (lintValidator) NeedsManifests() bool {
+	return false
+}
+
+func (v lintValidator) Validate(ctx context.Context, in *ValidationInput) ([]Finding, error) {
+	err := RunContext(ctx, in.Project.Lint(in.Case))
+	if err == nil {
+		return nil, nil
+	}
+	if ctx.Err() != nil {
+		return nil, err
+	}
+	out, readErr := os.ReadFile(in.Project.LintOutPath(in.Case))
+	if readErr != nil {
+		return nil, readErr
+	}
+	errorLines := make([]string, 0)
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.HasPrefix(line, "[ERROR]") || strings.HasPrefix(line, "Error") {
+			errorLines = append(errorLines, line)
+		}
+	}
+	return outputFindings(v.Name(), []byte(strings.Join(errorLines, "\n")), err), nil
+}
+
+// applyValidator validates the rendered manifests according to the project's apply mode, and reports
+// each error printed while doing so
+type applyValidator struct{}
+
+func (applyValidator) Name() ValidatorName {
+	return ValidatorApply
+}
+
+func (applyValidator) NeedsManifests() bool {
+	return true
+}
+
+func (v applyValidator) Validate(ctx context.Context, in *ValidationInput) ([]Finding, error) {
+	if in.Project.Settings.ApplyMode == ApplyModeSchema {
+		return in.Project.validateSchemaFindings(in)
+	}
+	apply := in.Project.apply(in.Case)
+	gosh.BytesIn(in.Manifests)(apply)
+	var cmd gosh.Commander = apply
+	if in.Project.Settings.ApplyMode == ApplyModeServer {
+		cmd = in.Project.inCaseNamespace(in.Case, apply)
+	}
+	err := RunContext(ctx, cmd)
+	if err == nil {
+		return nil, nil
+	}
+	if ctx.Err() != nil {
+		if in.Project.Settings.ApplyMode == ApplyModeServer {
+			// The namespace may have been created before the command was killed
+			in.Project.deleteCaseNamespace(in.Case).Run()
+		}
+		return nil, err
+	}
+	out, readErr := os.ReadFile(in.Project.ApplyErrPath(in.Case))
+	if readErr != nil && !os.IsNotExist(readErr) {
+		return nil, readErr
+	}
+	return outputFindings(v.Name(), out, err), nil
+}
+
+// validateSchemaFindings is the apply validator for ApplyModeSchema, which reports each schema violation as a separate finding
+func (l *LoadedProject) validateSchemaFindings(in *ValidationInput) ([]Finding, error) {
+	stdout, err := os.Create(l.ApplyOutPath(in.Case))
+	if err != nil {
+		return nil, err
+	}
+	defer stdout.Close()
+	stderr, err := os.Create(l.ApplyErrPath(in.Case))
+	if err != nil {
+		return nil, err
+	}
+	defer stderr.Close()
+	return l.validateSchemas(bytes.NewReader(in.Manifests), stdout, stderr)
+}
+
+func init() {
+	RegisterValidator(ValidatorLint, func(*LoadedProject) (Validator, error) { return lintValidator{}, nil })
+	RegisterValidator(ValidatorApply, func(*LoadedProject) (Validator, error) { return applyValidator{}, nil })
+}
@@ -0,0 +1,239 @@
+package helmhog
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"sigs.k8s.io/yaml"
+)
+
+// chartTestProject renders the chart in testdata with the SDK engine, failing to render and lint if greeting is not a string
+const chartTestProject = `
+apiVersion: helm-hog.meln5674.github.com/v1alpha1
+kind: Project
+chart: testdata/chart
+parts:
+  default: {}
+  broken: {config: {greeting: [hello]}}
+  replicated: {replicas: 3}
+  extra: {config: {extra: {farewell: goodbye}}}
+variables:
+  greeting: {default: [default], broken: [broken]}
+  scale: {single: [default], replicated: [replicated]}
+  config: {default: [default], extra: [extra]}
+`
+
+// fakeValidator returns the same findings for every case, after an optional delay
+type fakeValidator struct {
+	name           ValidatorName
+	needsManifests bool
+	delay          time.Duration
+	findings       []Finding
+	err            error
+	// sawManifests is set to whether or not the validator was given manifests
+	sawManifests *bool
+}
+
+func (v fakeValidator) Name() ValidatorName {
+	return v.name
+}
+
+func (v fakeValidator) NeedsManifests() bool {
+	return v.needsManifests
+}
+
+func (v fakeValidator) Validate(ctx context.Context, in *ValidationInput) ([]Finding, error) {
+	time.Sleep(v.delay)
+	*v.sawManifests = len(in.Manifests) != 0
+	return v.findings, v.err
+}
+
+func TestRegisteredValidators(t *testing.T) {
+	names := strings.Join(RegisteredValidators(), ",")
+	if names != "apply,assertions,lint" {
+		t.Errorf("RegisteredValidators() = %s", names)
+	}
+
+	l := loadTestProject(t, selectorTestProject)
+	for _, name := range []ValidatorName{ValidatorLint, ValidatorApply, ValidatorAssertions} {
+		validator, err := l.NewValidator(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if validator.Name() != name {
+			t.Errorf("NewValidator(%s) created %s", name, validator.Name())
+		}
+	}
+	_, err := l.NewValidator("kubescore")
+	if err == nil || !strings.Contains(err.Error(), "Unknown validator kubescore, must be one of apply, assertions, lint") {
+		t.Errorf("expected unknown validator error, got %v", err)
+	}
+}
+
+func TestRegisterValidatorRejectsDuplicates(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Registering %s again did not panic", ValidatorLint)
+		}
+	}()
+	RegisterValidator(ValidatorLint, func(*LoadedProject) (Validator, error) { return lintValidator{}, nil })
+}
+
+func TestLoadValidators(t *testing.T) {
+	l := loadTestProject(t, selectorTestProject)
+	names := make([]ValidatorName, 0, len(l.Validators))
+	for _, validator := range l.Validators {
+		names = append(names, validator.Name())
+	}
+	if strings.Join(names, ",") != strings.Join(DefaultValidators, ",") {
+		t.Errorf("Default validators are %v, want %v", names, DefaultValidators)
+	}
+
+	l = loadTestProject(t, selectorTestProject+"validators: [apply, lint]\n")
+	if len(l.Validators) != 2 || l.Validators[0].Name() != ValidatorApply || l.Validators[1].Name() != ValidatorLint {
+		t.Errorf("Validators were not loaded in the listed order")
+	}
+
+	tests := []struct {
+		validators string
+		err        string
+	}{
+		{validators: "validators: [lint, apply, lint]\n", err: "Validator lint is listed more than once"},
+		{validators: "validators: [lint, kubescore]\n", err: "Unknown validator kubescore"},
+		{validators: "validators: [lint]\nassertions: {a: {select: {kind: ConfigMap}, cel: 'true'}}\n", err: "the assertions validator is not listed"},
+	}
+	for _, test := range tests {
+		p := new(Project)
+		err := yaml.Unmarshal([]byte(selectorTestProject+test.validators), p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		l, err := p.Load(ProjectSettings{})
+		if err == nil {
+			l.RemoveTempDir()
+		}
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("expected error containing %q, got %v", test.err, err)
+		}
+	}
+}
+
+func TestRunValidators(t *testing.T) {
+	l := loadTestProjectWithSettings(t, chartTestProject, ProjectSettings{Engine: EngineSDK})
+	tests := []struct {
+		name string
+		c    Case
+		// stages are the names of the stages run, in sorted order
+		stages   string
+		findings string
+		err      string
+	}{
+		{
+			name:     "rendered",
+			c:        Case{"greeting": "default", "scale": "single", "config": "default"},
+			stages:   "early,late,slow,template",
+			findings: "slow: slow finding,early: early finding,late: late finding",
+		},
+		{
+			name:     "not rendered",
+			c:        Case{"greeting": "broken", "scale": "single", "config": "default"},
+			stages:   "early,template",
+			findings: "early: early finding",
+			err:      "wrong type",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := l.MakeCaseTempDir(test.c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var slowSaw, earlySaw, lateSaw bool
+			validators := []Validator{
+				// slow needs manifests and finishes last, but is listed first, so its findings are reported first
+				fakeValidator{name: "slow", needsManifests: true, delay: 200 * time.Millisecond, findings: []Finding{{Validator: "slow", Message: "slow finding"}}, sawManifests: &slowSaw},
+				fakeValidator{name: "early", findings: []Finding{{Validator: "early", Message: "early finding"}}, sawManifests: &earlySaw},
+				fakeValidator{name: "late", needsManifests: true, findings: []Finding{{Validator: "late", Message: "late finding"}}, sawManifests: &lateSaw},
+			}
+			stages := new(Stages)
+			findings, err := l.RunValidators(context.Background(), test.c, validators, stages)
+			if test.err == "" && err != nil {
+				t.Fatal(err)
+			}
+			if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Fatalf("expected error containing %q, got %v", test.err, err)
+			}
+
+			stageNames := make([]string, 0)
+			for _, stage := range stages.Results() {
+				stageNames = append(stageNames, stage.Name)
+			}
+			sort.Strings(stageNames)
+			if strings.Join(stageNames, ",") != test.stages {
+				t.Errorf("Ran stages %v, want %s", stageNames, test.stages)
+			}
+			findingStrings := make([]string, 0, len(findings))
+			for _, finding := range findings {
+				findingStrings = append(findingStrings, finding.String())
+			}
+			if strings.Join(findingStrings, ",") != test.findings {
+				t.Errorf("Got findings %v, want %s", findingStrings, test.findings)
+			}
+			if earlySaw {
+				t.Errorf("A validator which does not need manifests was given them")
+			}
+			if test.err == "" && (!slowSaw || !lateSaw) {
+				t.Errorf("A validator which needs manifests was not given them")
+			}
+			if _, err := os.Stat(l.FindingsPath(test.c)); err != nil {
+				t.Errorf("Findings were not written: %v", err)
+			}
+		})
+	}
+}
+
+func TestRunValidatorsStopsAtError(t *testing.T) {
+	l := loadTestProjectWithSettings(t, chartTestProject, ProjectSettings{Engine: EngineSDK})
+	c := Case{"greeting": "default", "scale": "single", "config": "default"}
+	err := l.MakeCaseTempDir(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var broken, skipped bool
+	validators := []Validator{
+		fakeValidator{name: "broken", needsManifests: true, err: errors.New("could not validate"), sawManifests: &broken},
+		fakeValidator{name: "skipped", needsManifests: true, findings: []Finding{{Validator: "skipped", Message: "not reported"}}, sawManifests: &skipped},
+	}
+	findings, err := l.RunValidators(context.Background(), c, validators, nil)
+	if err == nil || err.Error() != "validator broken: could not validate" {
+		t.Errorf("expected validator error, got %v", err)
+	}
+	if len(findings) != 0 || skipped {
+		t.Errorf("Validators after the one which errored were run")
+	}
+}
+
+func TestRunValidatorsLintsCasesWhichDoNotRender(t *testing.T) {
+	l := loadTestProjectWithSettings(t, chartTestProject+"validators: [lint, apply]\n", ProjectSettings{Engine: EngineSDK})
+	c := Case{"greeting": "broken", "scale": "single", "config": "default"}
+	err := l.MakeCaseTempDir(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	findings, err := l.RunValidators(context.Background(), c, l.Validators, nil)
+	if err == nil {
+		t.Fatal("expected rendering to fail")
+	}
+	if len(findings) == 0 || findings[0].Validator != ValidatorLint || !strings.Contains(findings[0].Message, "wrong type") {
+		t.Errorf("Expected lint findings, got %v", findings)
+	}
+	lintOut, err := os.ReadFile(l.LintOutPath(c))
+	if err != nil || !strings.Contains(string(lintOut), "wrong type") {
+		t.Errorf("lint.out does not explain the failure: %s, %v", lintOut, err)
+	}
+}